@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Binding keeps a copy of a struct in sync with a config.
+// See Config.Bind() for details.
+type Binding struct {
+	cfg *Config
+	typ reflect.Type
+	id  int
+
+	// mu serializes updates; readers only use `current`.
+	mu      sync.Mutex
+	current atomic.Value
+	err     error
+}
+
+// Bind fills the struct `v` points to like Unmarshal() does and returns a
+// Binding that keeps an up-to-date copy of it. Whenever a key of `cfg`
+// changes, a new copy is filled and swapped in atomically, so readers never
+// see a half-updated struct:
+//
+//	binding, err := cfg.Bind(&Settings{})
+//	...
+//	settings := binding.Load().(*Settings)
+//
+// The struct passed to Bind() is not updated later on and the structs
+// returned by Load() may not be modified, since they are shared between
+// readers. Call Close() to stop updating.
+func (cfg *Config) Bind(v interface{}) (*Binding, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("bind needs a pointer to a struct, got %T", v)
+	}
+
+	if err := cfg.Unmarshal(v); err != nil {
+		return nil, err
+	}
+
+	// Do not share the caller's struct with the readers:
+	initial := reflect.New(rv.Elem().Type())
+	initial.Elem().Set(rv.Elem())
+
+	bd := &Binding{
+		cfg: cfg,
+		typ: rv.Elem().Type(),
+	}
+
+	bd.current.Store(initial.Interface())
+	bd.id = cfg.AddChangeEvent("", func(change Change) {
+		bd.update()
+	})
+
+	// Something might have changed between Unmarshal() and AddChangeEvent():
+	bd.update()
+	return bd, nil
+}
+
+func (bd *Binding) update() {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	fresh := reflect.New(bd.typ)
+	if err := bd.cfg.Unmarshal(fresh.Interface()); err != nil {
+		// Keep the last good state.
+		bd.err = err
+		return
+	}
+
+	bd.err = nil
+	bd.current.Store(fresh.Interface())
+}
+
+// Load returns a pointer to the current version of the struct.
+// It has the same type as the pointer passed to Bind().
+// It is safe to call from several go routines.
+func (bd *Binding) Load() interface{} {
+	return bd.current.Load()
+}
+
+// Err returns the error of the last update, if it failed.
+// In this case Load() still returns the last good version.
+func (bd *Binding) Err() error {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	return bd.err
+}
+
+// Close stops updating the struct.
+func (bd *Binding) Close() error {
+	bd.cfg.RemoveEvent(bd.id)
+	return nil
+}
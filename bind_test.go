@@ -0,0 +1,71 @@
+package config
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBind(t *testing.T) {
+	cfg, err := openFromString("daemon:\n  port: 8080\n", testStructDefaults)
+	require.Nil(t, err)
+
+	settings := &testSettings{}
+	binding, err := cfg.Bind(settings)
+	require.Nil(t, err)
+	require.Equal(t, uint16(8080), settings.Daemon.Port)
+
+	first := binding.Load().(*testSettings)
+	require.Equal(t, uint16(8080), first.Daemon.Port)
+
+	require.Nil(t, cfg.SetInt("daemon.port", 9090))
+	require.Nil(t, cfg.SetString("mounts.music.path", "/music"))
+
+	curr := binding.Load().(*testSettings)
+	require.Equal(t, uint16(9090), curr.Daemon.Port)
+	require.Equal(t, "/music", curr.Mounts["music"].Path)
+
+	// Old versions are not modified:
+	require.Equal(t, uint16(8080), first.Daemon.Port)
+	require.Equal(t, uint16(8080), settings.Daemon.Port)
+
+	// Values that do not fit keep the last good version:
+	require.Nil(t, cfg.SetInt("daemon.port", 100000))
+	require.NotNil(t, binding.Err())
+	require.Equal(t, uint16(9090), binding.Load().(*testSettings).Daemon.Port)
+
+	require.Nil(t, binding.Close())
+	require.Nil(t, cfg.SetInt("daemon.port", 7070))
+	require.Equal(t, uint16(9090), binding.Load().(*testSettings).Daemon.Port)
+}
+
+func TestBindConcurrent(t *testing.T) {
+	cfg, err := Open(nil, testStructDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	binding, err := cfg.Section("daemon").Bind(&testDaemonSettings{})
+	require.Nil(t, err)
+	defer binding.Close()
+
+	wg := &sync.WaitGroup{}
+	for idx := 0; idx < 4; idx++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			for port := 1; port < 50; port++ {
+				tx := cfg.Begin()
+				require.Nil(t, tx.SetInt("daemon.port", int64(idx*1000+port)))
+				require.Nil(t, tx.SetDuration("daemon.timeout", time.Duration(idx*1000+port)*time.Second))
+				require.Nil(t, tx.Commit())
+
+				// Both values have to belong to the same commit:
+				curr := binding.Load().(*testDaemonSettings)
+				require.Equal(t, time.Duration(curr.Port)*time.Second, curr.Timeout)
+			}
+		}(idx)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ComplaintKind tells what kind of programmer error caused a complaint.
+type ComplaintKind int
+
+const (
+	// ComplaintInvalidKey is used when a key is not part of the defaults.
+	ComplaintInvalidKey = ComplaintKind(iota)
+	// ComplaintWrongType is used when the wrong getter was used for a key.
+	ComplaintWrongType
+	// ComplaintInvalidValue is used when a stored value can't be converted,
+	// e.g. a duration key without a duration validator.
+	ComplaintInvalidValue
+	// ComplaintBadDefaults is used when the defaults are faulty.
+	ComplaintBadDefaults
+	// ComplaintInternal is used for errors that should never happen.
+	ComplaintInternal
+)
+
+func (kind ComplaintKind) String() string {
+	switch kind {
+	case ComplaintInvalidKey:
+		return "invalid-key"
+	case ComplaintWrongType:
+		return "wrong-type"
+	case ComplaintInvalidValue:
+		return "invalid-value"
+	case ComplaintBadDefaults:
+		return "bad-defaults"
+	case ComplaintInternal:
+		return "internal"
+	default:
+		return "unknown"
+	}
+}
+
+// Complaint describes a programmer error. See Strictness for details.
+type Complaint struct {
+	Kind ComplaintKind
+
+	// Key is the full key the complaint is about. It might be empty.
+	Key string
+
+	// Msg is a human readable description of the error.
+	Msg string
+
+	// Strictness is the strictness of the config that complained.
+	Strictness Strictness
+
+	// Caller is the file:line of the call into this package
+	// that caused the complaint. It might be empty.
+	Caller string
+}
+
+func (c Complaint) String() string {
+	if c.Caller == "" {
+		return c.Msg
+	}
+
+	return fmt.Sprintf("%s (called from %s)", c.Msg, c.Caller)
+}
+
+// ComplaintHandler is called for every complaint.
+// See SetComplaintHandler() for details.
+//
+// The handler might be called while the config that complained is locked.
+// It must therefore not call any method of that config (or its sections),
+// otherwise it deadlocks. If it needs to, it should hand the complaint
+// over to another goroutine.
+type ComplaintHandler func(c Complaint)
+
+var (
+	complaintHandlerMu sync.RWMutex
+	complaintHandler   ComplaintHandler = DefaultComplaintHandler
+)
+
+// DefaultComplaintHandler logs the complaint via log.Println() on
+// StrictnessWarn and panics on StrictnessPanic.
+func DefaultComplaintHandler(c Complaint) {
+	switch c.Strictness {
+	case StrictnessWarn:
+		log.Println(c.Msg)
+	case StrictnessPanic:
+		panic(c.Msg)
+	}
+}
+
+// SetComplaintHandler sets the handler that is called instead of logging or
+// panicking when a programmer error was detected. It is called for every
+// config that uses StrictnessWarn or StrictnessPanic; configs with
+// StrictnessIgnore never complain. The handler decides on its own how to react
+// on c.Strictness. Call DefaultComplaintHandler() from it to keep the old
+// behaviour. Passing nil restores the default handler.
+//
+// The handler must not call back into the config; see ComplaintHandler.
+//
+// The previously set handler is returned, so it can be restored later.
+func SetComplaintHandler(handler ComplaintHandler) ComplaintHandler {
+	if handler == nil {
+		handler = DefaultComplaintHandler
+	}
+
+	complaintHandlerMu.Lock()
+	defer complaintHandlerMu.Unlock()
+
+	prev := complaintHandler
+	complaintHandler = handler
+	return prev
+}
+
+func complain(c Complaint, strictness Strictness) {
+	if strictness == StrictnessIgnore {
+		return
+	}
+
+	c.Strictness = strictness
+	c.Caller = complaintCaller()
+
+	complaintHandlerMu.RLock()
+	handler := complaintHandler
+	complaintHandlerMu.RUnlock()
+
+	handler(c)
+}
+
+// complaintCaller returns the position of the first caller that is outside
+// of this package's (non-test) source files.
+func complaintCaller() string {
+	_, ownFile, _, ok := runtime.Caller(0)
+	if !ok {
+		return ""
+	}
+
+	ownDir := filepath.Dir(ownFile)
+
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		isOwn := filepath.Dir(frame.File) == ownDir && !strings.HasSuffix(frame.File, "_test.go")
+		if frame.File != "" && !isOwn {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+
+		if !more {
+			return ""
+		}
+	}
+}
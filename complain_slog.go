@@ -0,0 +1,29 @@
+//go:build go1.21
+
+package config
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogComplaintHandler returns a ComplaintHandler that logs every complaint
+// to `logger`. Complaints of configs with StrictnessPanic are logged as
+// errors, all others as warnings. It never panics.
+func SlogComplaintHandler(logger *slog.Logger) ComplaintHandler {
+	return func(c Complaint) {
+		level := slog.LevelWarn
+		if c.Strictness == StrictnessPanic {
+			level = slog.LevelError
+		}
+
+		logger.Log(
+			context.Background(),
+			level,
+			c.Msg,
+			slog.String("kind", c.Kind.String()),
+			slog.String("key", c.Key),
+			slog.String("caller", c.Caller),
+		)
+	}
+}
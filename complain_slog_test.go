@@ -0,0 +1,27 @@
+//go:build go1.21
+
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogComplaintHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	prev := SetComplaintHandler(SlogComplaintHandler(slog.New(slog.NewTextHandler(buf, nil))))
+	defer SetComplaintHandler(prev)
+
+	cfg, err := Open(nil, TestDefaults, StrictnessPanic)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), cfg.Int("not.existing"))
+
+	out := buf.String()
+	require.Contains(t, out, "level=ERROR")
+	require.Contains(t, out, "kind=invalid-key")
+	require.Contains(t, out, "key=not.existing")
+	require.Contains(t, out, "complain_slog_test.go:")
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComplaintHandler(t *testing.T) {
+	complaints := []Complaint{}
+	prev := SetComplaintHandler(func(c Complaint) {
+		complaints = append(complaints, c)
+	})
+	defer SetComplaintHandler(prev)
+
+	cfg, err := Open(nil, TestDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	// Should not panic, since the handler decides what to do:
+	require.False(t, cfg.Bool("fs.compress.default_algo"))
+	require.NotNil(t, cfg.SetInt("not.existing", 1))
+
+	require.Len(t, complaints, 2)
+	require.Equal(t, ComplaintWrongType, complaints[0].Kind)
+	require.Equal(t, "fs.compress.default_algo", complaints[0].Key)
+	require.Equal(t, StrictnessPanic, complaints[0].Strictness)
+
+	require.Equal(t, ComplaintInvalidKey, complaints[1].Kind)
+	require.Equal(t, "not.existing", complaints[1].Key)
+
+	// The caller should point to this test, not to the package internals:
+	require.True(t, strings.Contains(complaints[1].Caller, "complain_test.go:"), complaints[1].Caller)
+
+	// Ignore never complains:
+	cfg, err = Open(nil, TestDefaults, StrictnessIgnore)
+	require.Nil(t, err)
+	require.NotNil(t, cfg.SetInt("not.existing", 1))
+	require.Len(t, complaints, 2)
+}
+
+func TestComplaintHandlerDefault(t *testing.T) {
+	prev := SetComplaintHandler(nil)
+	defer SetComplaintHandler(prev)
+
+	cfg, err := Open(nil, TestDefaults, StrictnessPanic)
+	require.Nil(t, err)
+	require.Panics(t, func() { cfg.String("not.existing") })
+}
@@ -25,9 +25,8 @@
 package config
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
-	"log"
 	"reflect"
 	"regexp"
 	"sort"
@@ -57,6 +56,7 @@ const (
 	// StrictnessIgnore silently ignores any programmer error
 	StrictnessIgnore = Strictness(iota)
 	// StrictnessWarn will log a complaint via log.Println()
+	// or pass it to the handler set by SetComplaintHandler()
 	StrictnessWarn
 	// StrictnessPanic will panic when a programmer error was made.
 	StrictnessPanic
@@ -96,6 +96,9 @@ var (
 	versionTag = regexp.MustCompile(`^# version:\s*(\d+).*`)
 	// manyMarker is a special key in the default mapping
 	manyMarker = "__many__"
+	// validateMarker is a special key in the default mapping,
+	// that holds a ConfigValidator for the section it is placed in.
+	validateMarker = "__validate__"
 )
 
 func getDefaultSectionByKeys(keys []string, defaults DefaultMapping, strictness Strictness) DefaultMapping {
@@ -107,26 +110,8 @@ func getDefaultSectionByKeys(keys []string, defaults DefaultMapping, strictness
 	if !hasChild {
 		// The key might still be used if we have a __many__ entry.
 		// If not, it has to be a wrong key.
-		placeHolderFound := false
-		for defaultKeyVal := range defaults {
-			defaultKey, ok := defaultKeyVal.(string)
-			if !ok {
-				complain(
-					fmt.Sprintf("bug: default key is not a string: %v", defaultKeyVal),
-					strictness,
-				)
-
-				return nil
-			}
-
-			// We found a __many__ entry. Use it as validation base.
-			if defaultKey == manyMarker {
-				child = defaults[manyMarker]
-				placeHolderFound = true
-			}
-		}
-
-		if !placeHolderFound {
+		child, hasChild = defaults[manyMarker]
+		if !hasChild {
 			return nil
 		}
 	}
@@ -156,7 +141,11 @@ func getDefaultByKeys(keys []string, defaults DefaultMapping, strictness Strictn
 
 	lastKey := keys[len(keys)-1]
 	if lastKey == manyMarker {
-		complain("__many__ used for default entries", strictness)
+		complain(Complaint{
+			Kind: ComplaintBadDefaults,
+			Key:  strings.Join(keys, "."),
+			Msg:  "__many__ used for default entries",
+		}, strictness)
 		return nil
 	}
 
@@ -248,6 +237,10 @@ func generalizeScalarType(val interface{}) interface{} {
 	// Since this is a config we do not care very much for extremely
 	// big numbers and can therefore convert all numbers to int64.
 	// The code below does that + something similar for float{32,64}.
+	if num, ok := val.(json.Number); ok {
+		return generalizeNumber(num, "")
+	}
+
 	if typeIntPattern.MatchString(getTypeOf(val)) {
 		destType := reflect.TypeOf(int64(0))
 		val = reflect.ValueOf(val).Convert(destType).Int()
@@ -261,7 +254,29 @@ func generalizeScalarType(val interface{}) interface{} {
 	return val
 }
 
+// generalizeNumber converts a number that was not yet typed by the decoder
+// (e.g. JSON) to the type mandated by `defType`. If `defType` is not a float
+// type, the number is converted to an int64, if it has no fractional part.
+func generalizeNumber(num json.Number, defType string) interface{} {
+	if !typeFloatPattern.MatchString(defType) {
+		if i, err := num.Int64(); err == nil {
+			return i
+		}
+	}
+
+	if f, err := num.Float64(); err == nil {
+		return f
+	}
+
+	// Let the type check complain about it:
+	return num.String()
+}
+
 func generalizeType(val interface{}, defType string) (interface{}, error) {
+	if num, ok := val.(json.Number); ok {
+		return generalizeNumber(num, defType), nil
+	}
+
 	if typ := reflect.TypeOf(val); typ.Kind() == reflect.Slice {
 		interfaces := val.([]interface{})
 		switch defType {
@@ -295,6 +310,10 @@ func generalizeType(val interface{}, defType string) (interface{}, error) {
 		case "[float32]", "[float64]":
 			results := []float64{}
 			for _, inter := range interfaces {
+				if num, ok := inter.(json.Number); ok {
+					inter = generalizeNumber(num, defType)
+				}
+
 				inter = generalizeScalarType(inter)
 				val, ok := inter.(float64)
 				if !ok {
@@ -401,13 +420,17 @@ func mergeDefaults(base map[interface{}]interface{}, overlay DefaultMapping, def
 	return nil
 }
 
-// validationChecker validates the incoming config
+// validationChecker validates the incoming config.
+// All invalid keys are reported at once as ValidationErrors.
+// If known, `positions` tells where each key was found in the source.
 func validationChecker(
 	root map[interface{}]interface{},
 	defaults DefaultMapping,
 	defaultKeys map[string]struct{},
+	positions map[string]Position,
 	strictness Strictness,
 ) error {
+	validationErrs := ValidationErrors{}
 	err := keys(root, nil, func(section map[interface{}]interface{}, key []string) error {
 		// It's a scalar key. Let's run some diagnostics.
 		lastKey := key[len(key)-1]
@@ -416,7 +439,14 @@ func validationChecker(
 		fullKey := strings.Join(key, ".")
 		defaultEntry := getDefaultByKey(fullKey, defaults, strictness)
 		if defaultEntry == nil {
-			return fmt.Errorf("no default for key: %v", fullKey)
+			validationErrs = append(validationErrs, &ValidationError{
+				Key:   fullKey,
+				Value: child,
+				Got:   getTypeOf(child),
+				Pos:   positions[fullKey],
+				Err:   &InvalidKeyError{Key: fullKey},
+			})
+			return nil
 		}
 
 		defType := getTypeOf(defaultEntry.Default)
@@ -424,25 +454,53 @@ func validationChecker(
 			return fmt.Errorf("no default found for key `%v`", fullKey)
 		}
 
+		// Untyped numbers can only be typed once we know the default:
+		if num, ok := child.(json.Number); ok {
+			child = generalizeNumber(num, defType)
+		}
+
 		valType := getTypeOf(child)
 		if !isCompatibleType(valType, defType) {
-			return fmt.Errorf(
-				"type mismatch: want `%v`, got `%v` for key `%v`",
-				defType,
-				valType,
-				fullKey,
-			)
+			validationErrs = append(validationErrs, &ValidationError{
+				Key:   fullKey,
+				Value: child,
+				Want:  defType,
+				Got:   valType,
+				Pos:   positions[fullKey],
+				Err: &TypeMismatchError{
+					Key:  fullKey,
+					Want: defType,
+					Got:  valType,
+				},
+			})
+			return nil
 		}
 
 		generalizedChild, err := generalizeType(child, defType)
 		if err != nil {
-			return err
+			validationErrs = append(validationErrs, &ValidationError{
+				Key:   fullKey,
+				Value: child,
+				Want:  defType,
+				Got:   valType,
+				Pos:   positions[fullKey],
+				Err:   err,
+			})
+			return nil
 		}
 
 		// Do user defined validation:
 		if defaultEntry.Validator != nil {
 			if err := defaultEntry.Validator(generalizedChild); err != nil {
-				return err
+				validationErrs = append(validationErrs, &ValidationError{
+					Key:   fullKey,
+					Value: generalizedChild,
+					Want:  defType,
+					Got:   valType,
+					Pos:   positions[fullKey],
+					Err:   err,
+				})
+				return nil
 			}
 		}
 
@@ -455,32 +513,65 @@ func validationChecker(
 		return err
 	}
 
+	if len(validationErrs) > 0 {
+		validationErrs.sort()
+		return validationErrs
+	}
+
 	// Fill in keys that are not present in the passed config:
 	return mergeDefaults(root, defaults, defaultKeys, "")
 }
 
 ////////////
 
-// keyChangedEvent is a single entry added by AddChangedKeyEvent
+// keyChangedEvent is a single entry added by AddEvent or AddChangeEvent
 type keyChangedEvent struct {
-	fn  func(key string)
-	key string
+	// Only one of those two is set:
+	fn       func(key string)
+	changeFn func(change Change)
+
+	key     string
+	section string
 }
 
 // Config is a helper that is built around a representation defined by a Encoder/Decoder.
 // It supports typed gets and sets, change notifications and
 // basic validation with defaults.
+//
+// All methods are safe to call from several goroutines. The getters do not
+// take a lock, so reads do not contend with each other or with writers.
 type Config struct {
 	mu *sync.Mutex
 
 	section         string
 	defaults        DefaultMapping
-	memory          map[interface{}]interface{}
-	callbackCount   int
+	index           *keyIndex
+	state           *memoryState
+	started         *memoryState
+	callbackCount   *int
 	changeCallbacks map[string]map[int]keyChangedEvent
 	defaultKeys     map[string]struct{}
 	version         Version
 	strictness      Strictness
+
+	// overrides maps keys that were set by ApplyEnv() and friends
+	// to their override. Those should not be saved.
+	overrides map[string]overrideEntry
+
+	// keyChecks caches the type checks of typed keys (see Key()).
+	keyChecks *sync.Map
+}
+
+// overrideEntry describes a key that was set by ApplyEnv() or ApplyFlags().
+type overrideEntry struct {
+	// val is the value the key was overridden with.
+	val interface{}
+
+	// saved is the value the key had before; Save() writes it instead of val.
+	saved interface{}
+
+	// wasDefault is true if saved was taken from the defaults.
+	wasDefault bool
 }
 
 func prefixKey(section, key string) string {
@@ -514,53 +605,85 @@ func Open(dec Decoder, defaults DefaultMapping, strictness Strictness) (*Config,
 		version = Version(0)
 	}
 
-	return open(version, memory, defaults, strictness)
+	return open(version, memory, decoderPositions(dec), defaults, strictness)
 }
 
 // open does the actual struct creation. It is also used by the migrater.
 func open(
 	version Version,
 	memory map[interface{}]interface{},
+	positions map[string]Position,
 	defaults DefaultMapping,
 	strictness Strictness,
 ) (*Config, error) {
+	index, err := newKeyIndex(defaults)
+	if err != nil {
+		return nil, e.Wrapf(err, "defaults")
+	}
+
 	defaultKeys := make(map[string]struct{})
-	if err := validationChecker(memory, defaults, defaultKeys, strictness); err != nil {
+	if err := validationChecker(memory, defaults, defaultKeys, positions, strictness); err != nil {
+		return nil, e.Wrapf(err, "validate")
+	}
+
+	if err := runConfigValidators(memory, index, defaultKeys, strictness); err != nil {
 		return nil, e.Wrapf(err, "validate")
 	}
 
 	return &Config{
 		mu:              &sync.Mutex{},
 		defaults:        defaults,
-		memory:          memory,
+		index:           index,
+		state:           newMemoryState(memory),
+		started:         newMemoryState(memory),
 		version:         version,
+		callbackCount:   new(int),
 		changeCallbacks: make(map[string]map[int]keyChangedEvent),
 		defaultKeys:     defaultKeys,
 		strictness:      strictness,
+		overrides:       make(map[string]overrideEntry),
+		keyChecks:       &sync.Map{},
 	}, nil
 }
 
-func complain(msg string, strictness Strictness) {
-	switch strictness {
-	case StrictnessWarn:
-		log.Println(msg)
-	case StrictnessPanic:
-		panic(msg)
-	default:
-		return
-	}
+// invalidKey complains about `key` and returns the error for it.
+func (cfg *Config) invalidKey(key string) error {
+	err := &InvalidKeyError{Key: key}
+	complain(Complaint{
+		Kind: ComplaintInvalidKey,
+		Key:  key,
+		Msg:  "bug: " + err.Error(),
+	}, cfg.strictness)
+	return err
 }
 
 // Reload re-sets all values in the config to the data in `dec`.
 // If `dec` is nil, all default values will be returned.
 // All keys that changed will trigger a signal, if registered.
+// Keys that were overridden by ApplyEnv() or ApplyFlags() keep their
+// override; the new value is only used by Save().
 //
 // Note that you cannot pass different defaults on Reload,
 // since this might alter the structure of the config,
 // potentially causing incompatibillies. Use the migration
 // interface if you really need to change the layout.
 func (cfg *Config) Reload(dec Decoder) error {
+	_, err := cfg.ReloadWithReport(dec)
+	return err
+}
+
+// ReloadWithReport works like Reload(), but also returns which keys changed
+// and which of those need a restart of the application to take effect.
+func (cfg *Config) ReloadWithReport(dec Decoder) (ChangeReport, error) {
 	cfg.mu.Lock()
+
+	events := []pendingEvent{}
+	defer func() {
+		// Call the callbacks without the lock:
+		fireEvents(events)
+	}()
+
+	// NOTE: the unlock is called before the other defer!
 	defer cfg.mu.Unlock()
 
 	var memory map[interface{}]interface{}
@@ -570,59 +693,114 @@ func (cfg *Config) Reload(dec Decoder) error {
 	if dec != nil {
 		version, memory, err = dec.Decode()
 		if err != nil {
-			return err
+			return ChangeReport{}, err
 		}
 	} else {
 		memory = make(map[interface{}]interface{})
 		version = Version(0)
 	}
 
-	// old config used to check for old values:
-	oldCfg := &Config{
-		memory:        cfg.memory,
-		version:       cfg.version,
-		defaults:      cfg.defaults,
-		callbackCount: cfg.callbackCount,
-		defaultKeys:   cfg.defaultKeys,
-		section:       cfg.section,
-		strictness:    cfg.strictness,
+	oldMemory := cfg.state.load()
+
+	defaultKeys := make(map[string]struct{})
+	if err := validationChecker(memory, cfg.defaults, defaultKeys, decoderPositions(dec), cfg.strictness); err != nil {
+		return ChangeReport{}, e.Wrapf(err, "validate")
 	}
 
-	if err := validationChecker(memory, cfg.defaults, cfg.defaultKeys, cfg.strictness); err != nil {
-		return e.Wrapf(err, "validate")
+	overrides := cfg.reapplyOverrides(memory, defaultKeys)
+	if err := runConfigValidators(memory, cfg.index, defaultKeys, cfg.strictness); err != nil {
+		return ChangeReport{}, e.Wrapf(err, "validate")
 	}
 
-	cfg.memory = memory
+	cfg.state.store(memory)
 	cfg.version = version
 
-	// Keys did not change, since it's the same defaults:
-	callbacks := []keyChangedEvent{}
-	for _, key := range cfg.keys() {
-		if !reflect.DeepEqual(oldCfg.get(key), cfg.get(key)) {
-			callbacks = append(callbacks, cfg.gatherCallbacks(key)...)
-		}
+	// The map is shared with sections, so update it in place:
+	for key := range cfg.defaultKeys {
+		delete(cfg.defaultKeys, key)
 	}
 
-	for _, callback := range callbacks {
-		callback.fn(callback.key)
+	for key := range defaultKeys {
+		cfg.defaultKeys[key] = struct{}{}
 	}
 
-	return nil
+	// The map is shared with sections too:
+	cfg.clearOverrides()
+	for key, entry := range overrides {
+		cfg.overrides[key] = entry
+	}
+
+	changes := cfg.memoryChanges(oldMemory, memory, OriginReload)
+	for _, change := range changes {
+		events = append(events, cfg.gatherCallbacks(change)...)
+	}
+
+	return cfg.newReport(changes), nil
 }
 
 // Save will write a representation defined by `enc` of the current config to `w`.
+// Values that were overridden by ApplyEnv() are saved with their previous value.
 func (cfg *Config) Save(enc Encoder) error {
 	cfg.mu.Lock()
 	defer cfg.mu.Unlock()
 
-	return enc.Encode(cfg.version, cfg.memory)
+	memory := cfg.state.load()
+	if len(cfg.overrides) > 0 {
+		memory = copyMemory(memory)
+		for key, entry := range cfg.overrides {
+			if parent, base := splitKeyRecursive(strings.Split(key, "."), memory, false); parent != nil {
+				parent[base] = entry.saved
+			}
+		}
+	}
+
+	if dke, ok := enc.(DefaultKeysEncoder); ok {
+		defaultKeys := make(map[string]struct{}, len(cfg.defaultKeys))
+		for key := range cfg.defaultKeys {
+			defaultKeys[key] = struct{}{}
+		}
+
+		for key, entry := range cfg.overrides {
+			if entry.wasDefault {
+				defaultKeys[key] = struct{}{}
+			}
+		}
+
+		dke.SetDefaultKeys(defaultKeys)
+	}
+
+	return enc.Encode(cfg.version, memory)
+}
+
+// clearOverrides forgets all overrides. Call with cfg.mu locked.
+// The map is cleared in place, since it is shared with sections.
+func (cfg *Config) clearOverrides() {
+	for key := range cfg.overrides {
+		delete(cfg.overrides, key)
+	}
+}
+
+// copyMemory returns a deep copy of the sections in `memory`.
+// Values are not copied, since they are never modified in place.
+func copyMemory(memory map[interface{}]interface{}) map[interface{}]interface{} {
+	result := make(map[interface{}]interface{}, len(memory))
+	for key, child := range memory {
+		if section, ok := child.(map[interface{}]interface{}); ok {
+			child = copyMemory(section)
+		}
+
+		result[key] = child
+	}
+
+	return result
 }
 
 ////////////
 
-// splitKey splits `key` into it's parent container and base key
+// splitKey splits `key` into it's parent container and base key.
+// The returned container may not be modified.
 func (cfg *Config) splitKey(key string, sectionAllowed bool) (map[interface{}]interface{}, string) {
-	return splitKeyRecursive(strings.Split(key, "."), cfg.memory, sectionAllowed)
+	return splitKeyRecursive(strings.Split(key, "."), cfg.state.load(), sectionAllowed)
 }
 
 // actual worker for splitKey
@@ -655,135 +833,242 @@ func splitKeyRecursive(keys []string, root map[interface{}]interface{}, sectionA
 
 // get is the worker for the higher level typed accessors
 func (cfg *Config) get(key string) interface{} {
+	return cfg.getFrom(cfg.state.snapshot(), key)
+}
+
+// getFrom works like get, but reads from the memory in `snap`.
+func (cfg *Config) getFrom(snap *memorySnapshot, key string) interface{} {
+	if val, ok := cfg.lookupFrom(snap, key); ok {
+		return val
+	}
+
+	// It is not present in the memory.
+	// Maybe it's an entry below __many__?
 	key = prefixKey(cfg.section, key)
-	parent, base := cfg.splitKey(key, false)
-	if parent == nil {
-		// It is not present in cfg.memory.
-		// Maybe it's an entry below __many__?
-		defEntry := getDefaultByKey(key, cfg.defaults, cfg.strictness)
-		if defEntry != nil {
-			return defEntry.Default
-		}
+	if defEntry := cfg.index.entry(key); defEntry != nil {
+		return defEntry.Default
+	}
 
-		complain(
-			fmt.Sprintf("bug: invalid config key: %v", key),
-			cfg.strictness,
-		)
-		return nil
+	cfg.invalidKey(key)
+	return nil
+}
+
+// lookupFrom returns the value of the relative `key` in the flat values of
+// `snap`. Unlike prefixKey(), the full key of a section is built on the stack,
+// so reading a value does not allocate.
+func (cfg *Config) lookupFrom(snap *memorySnapshot, key string) (interface{}, bool) {
+	if cfg.section == "" {
+		val, ok := snap.values[key]
+		return val, ok
 	}
 
-	return parent[base]
+	var buf [128]byte
+	fullKey := append(buf[:0], strings.Trim(cfg.section, ".")...)
+	fullKey = append(fullKey, '.')
+	fullKey = append(fullKey, strings.Trim(key, ".")...)
+
+	// The conversion in the map index does not copy the key:
+	val, ok := snap.values[string(fullKey)]
+	return val, ok
 }
 
 // call this with cfg.mu locked!
-func (cfg *Config) gatherCallbacks(key string) []keyChangedEvent {
-	callbacks := []keyChangedEvent{}
-	for _, ckey := range []string{key, ""} {
+func (cfg *Config) gatherCallbacks(change Change) []pendingEvent {
+	change.NeedsRestart = cfg.needsRestart(change.Key)
+
+	events := []pendingEvent{}
+	for _, ckey := range []string{change.Key, ""} {
 		if ckey == "" || strings.HasPrefix(ckey, cfg.section) {
 			if bucket, ok := cfg.changeCallbacks[ckey]; ok {
 				for _, callback := range bucket {
-					callbacks = append(callbacks, callback)
+					if !isInSection(change.Key, callback.section) {
+						// catch-all callback of another section.
+						continue
+					}
+
+					events = append(events, pendingEvent{
+						event:  callback,
+						change: change,
+					})
 				}
 			}
 		}
 	}
 
-	return callbacks
-}
-
-func (cfg *Config) punchHole(key []string, root map[interface{}]interface{}) (map[interface{}]interface{}, string, error) {
-	if len(key) == 0 {
-		return nil, "", nil
-	}
-
-	if len(key) == 1 {
-		return root, key[0], nil
-	}
-
-	child, ok := root[key[0]]
-	if !ok {
-		child = make(map[interface{}]interface{})
-		root[key[0]] = child
-	}
-
-	section, ok := child.(map[interface{}]interface{})
-	if !ok {
-		return nil, "", fmt.Errorf("trying to override value with section: %v", key)
-	}
-
-	return cfg.punchHole(key[1:], section)
+	return events
 }
 
 // setLocked is worker behind the Set*() methods.
 func (cfg *Config) setLocked(key string, val interface{}) error {
+	return cfg.setWithOrigin(key, val, OriginSet)
+}
+
+// setWithOrigin works like setLocked, but allows to specify
+// where the change came from.
+func (cfg *Config) setWithOrigin(key string, val interface{}, origin ChangeOrigin) error {
 	cfg.mu.Lock()
 
 	key = prefixKey(cfg.section, key)
-	callbacks := []keyChangedEvent{}
+	events := []pendingEvent{}
 	defer func() {
 		// Call the callbacks without the lock:
-		for _, callback := range callbacks {
-			callback.fn(callback.key)
-		}
+		fireEvents(events)
 	}()
 
 	// NOTE: the unlock is called before the other defer!
 	defer cfg.mu.Unlock()
 
-	parent, base := cfg.splitKey(key, false)
-	if parent == nil {
-		// section, sectionBase := cfg.splitKey(key, true)
-		// mergeDefaults(, , cfg.defaultKeys, cfg.section)
-		def := getDefaultByKey(key, cfg.defaults, cfg.strictness)
-		if def != nil {
-			splitKey := strings.Split(key, ".")
-
-			var err error
-			parent, base, err = cfg.punchHole(splitKey, cfg.memory)
-			if err != nil {
-				return err
-			}
+	// The caller might modify the slice later on:
+	val = copySlice(val)
+	if err := cfg.checkSet(key, val); err != nil {
+		return err
+	}
 
-			parent[base] = def.Default
-		} else {
-			msg := fmt.Sprintf("bug: invalid config key: %v", key)
-			complain(msg, cfg.strictness)
-			return errors.New(msg)
-		}
+	if err := cfg.checkConfigValidators(map[string]interface{}{key: val}); err != nil {
+		return err
 	}
 
-	defType := getTypeOf(parent[base])
-	valType := getTypeOf(val)
+	var err error
+	events, err = cfg.applySet(key, val, origin)
+	return err
+}
 
-	if !isCompatibleType(defType, valType) {
-		return fmt.Errorf(
-			"wrong type in set for key `%v`: want: `%v` but got `%v`",
-			key, defType, valType,
-		)
+// currentValue returns the value of the full `key` or its default,
+// if it was not set yet. Call with cfg.mu locked.
+func (cfg *Config) currentValue(key string) (interface{}, error) {
+	if val, ok := cfg.state.lookup(key); ok {
+		return val, nil
 	}
 
-	// Remember that we've overwritten this key:
-	delete(cfg.defaultKeys, key)
+	if def := cfg.index.entry(key); def != nil {
+		return def.Default, nil
+	}
 
-	// Check if something was changed. If not we do not need to notify anyone.
-	if reflect.DeepEqual(val, parent[base]) {
+	return nil, cfg.invalidKey(key)
+}
+
+// checkSet checks if the full `key` can be set to `val` without modifying
+// anything. Call with cfg.mu locked.
+func (cfg *Config) checkSet(key string, val interface{}) error {
+	curr, err := cfg.currentValue(key)
+	if err != nil {
+		return err
+	}
+
+	currType := getTypeOf(curr)
+	valType := getTypeOf(val)
+
+	// Report the type like validation on Open() does:
+	defEntry := cfg.index.entry(key)
+	defType := getTypeOf(defEntry.Default)
+
+	if !isCompatibleType(currType, valType) {
+		return &TypeMismatchError{
+			Key:  key,
+			Want: defType,
+			Got:  valType,
+		}
+	}
+
+	// Nothing will change, so there is nothing to validate.
+	if reflect.DeepEqual(val, curr) {
 		return nil
 	}
 
 	// If there is an validator defined, we should check now.
-	defEntry := getDefaultByKey(key, cfg.defaults, cfg.strictness)
 	if defEntry.Validator != nil {
 		if err := defEntry.Validator(val); err != nil {
-			return err
+			return &ValidationError{
+				Key:   key,
+				Value: val,
+				Want:  defType,
+				Got:   valType,
+				Err:   err,
+			}
 		}
 	}
 
-	parent[base] = val
-	callbacks = cfg.gatherCallbacks(key)
-
 	return nil
 }
 
+// applySet sets the full `key` to `val`, which must have passed checkSet().
+// It returns the events that need to be fired. Call with cfg.mu locked.
+func (cfg *Config) applySet(key string, val interface{}, origin ChangeOrigin) ([]pendingEvent, error) {
+	memory, change, err := cfg.stageSet(cfg.state.load(), key, val, origin)
+	if err != nil {
+		return nil, err
+	}
+
+	if memory != nil {
+		cfg.state.storeChanged(memory, map[string]interface{}{key: val})
+	}
+
+	cfg.markSet(key)
+
+	if change == nil {
+		return nil, nil
+	}
+
+	return cfg.gatherCallbacks(*change), nil
+}
+
+// stageSet returns a version of `memory` with the full `key` set to `val`,
+// which must have passed checkSet(). The returned memory is nil if it does
+// not need to be modified and the change is nil if the value did not change.
+// Nothing is modified. Call with cfg.mu locked.
+func (cfg *Config) stageSet(
+	memory map[interface{}]interface{},
+	key string,
+	val interface{},
+	origin ChangeOrigin,
+) (map[interface{}]interface{}, *Change, error) {
+	oldVal, inMemory := cfg.state.lookup(key)
+	if !inMemory {
+		// Not in memory yet, probably an entry below __many__.
+		def := cfg.index.entry(key)
+		if def == nil {
+			return nil, nil, cfg.invalidKey(key)
+		}
+
+		oldVal = def.Default
+	}
+
+	// Check if something was changed. If not we do not need to notify anyone.
+	unchanged := reflect.DeepEqual(val, oldVal)
+	if unchanged && inMemory {
+		return nil, nil, nil
+	}
+
+	memory, err := setInMemory(memory, strings.Split(key, "."), val)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if unchanged {
+		return memory, nil, nil
+	}
+
+	kind := ChangeModified
+	if !inMemory {
+		kind = ChangeAdded
+	}
+
+	return memory, &Change{
+		Key:    key,
+		Old:    oldVal,
+		New:    val,
+		Origin: origin,
+		Kind:   kind,
+	}, nil
+}
+
+// markSet remembers that the full `key` was set explicitly.
+// Call with cfg.mu locked.
+func (cfg *Config) markSet(key string) {
+	delete(cfg.defaultKeys, key)
+	delete(cfg.overrides, key)
+}
+
 ////////////
 
 // AddEvent registers a callback to be called when `key` is changed.
@@ -793,22 +1078,25 @@ func (cfg *Config) setLocked(key string, val interface{}) error {
 // The returned id can be used to unregister a callback with RemoveEvent()
 // Note: This function will panic when using an invalid key.
 func (cfg *Config) AddEvent(key string, fn func(key string)) int {
+	return cfg.addEvent(keyChangedEvent{
+		fn:  fn,
+		key: key,
+	})
+}
+
+// addEvent is the worker behind AddEvent and AddChangeEvent.
+func (cfg *Config) addEvent(event keyChangedEvent) int {
 	cfg.mu.Lock()
 	defer cfg.mu.Unlock()
 
-	event := keyChangedEvent{
-		fn:  fn,
-		key: key,
-	}
+	key := event.key
+	event.section = cfg.section
 
 	if key != "" {
 		key = prefixKey(cfg.section, key)
-		defaultEntry := getDefaultByKey(key, cfg.defaults, cfg.strictness)
+		defaultEntry := cfg.index.entry(key)
 		if defaultEntry == nil {
-			complain(
-				fmt.Sprintf("bug: invalid config key: %v", key),
-				cfg.strictness,
-			)
+			cfg.invalidKey(key)
 			return 0
 		}
 	}
@@ -819,10 +1107,10 @@ func (cfg *Config) AddEvent(key string, fn func(key string)) int {
 		cfg.changeCallbacks[key] = callbacks
 	}
 
-	oldCount := cfg.callbackCount
+	oldCount := *cfg.callbackCount
 	callbacks[oldCount] = event
 
-	cfg.callbackCount++
+	*cfg.callbackCount++
 
 	return oldCount
 }
@@ -850,7 +1138,10 @@ func (cfg *Config) ClearEvents() {
 	cfg.mu.Lock()
 	defer cfg.mu.Unlock()
 
-	cfg.changeCallbacks = make(map[string]map[int]keyChangedEvent)
+	// The map is shared with sections, so clear it in place:
+	for key := range cfg.changeCallbacks {
+		delete(cfg.changeCallbacks, key)
+	}
 }
 
 ////////////
@@ -861,21 +1152,23 @@ func (cfg *Config) checkZeroType(key string, val, zero interface{}) interface{}
 
 	if valTyp.ConvertibleTo(zeroTyp) {
 		// We can convert the types, all good.
-		return reflect.ValueOf(val).Convert(zeroTyp).Interface()
+		// Slices are copied, since the memory is shared with other readers.
+		return copySlice(reflect.ValueOf(val).Convert(zeroTyp).Interface())
 	}
 
 	// Let's complain about the wrong type.
 	// The user of the api probably used he wrong type for this key.
 	// (i.e. Bool() for a string)
-	complain(
-		fmt.Sprintf(
+	complain(Complaint{
+		Kind: ComplaintWrongType,
+		Key:  prefixKey(cfg.section, key),
+		Msg: fmt.Sprintf(
 			"bug: wrong type in get for key `%s`. Want `%s`, but got `%s`. Wrong getter used?",
 			key,
 			zeroTyp.Name(),
 			valTyp.Name(),
 		),
-		cfg.strictness,
-	)
+	}, cfg.strictness)
 	return zero
 }
 
@@ -884,186 +1177,77 @@ func (cfg *Config) checkZeroType(key string, val, zero interface{}) interface{}
 // Note: This function might panic when they key does not exist and StrictnessPanic is used.
 // If an error happens it will return the zero value.
 func (cfg *Config) Get(key string) interface{} {
-	cfg.mu.Lock()
-	defer cfg.mu.Unlock()
-
-	return cfg.get(key)
+	return cfg.Snapshot().Get(key)
 }
 
 // Bool returns the boolean value (or default) at `key`.
 // Note: This function might panic when they key does not exist and StrictnessPanic is used.
 // If an error happens it will return the zero value.
 func (cfg *Config) Bool(key string) bool {
-	cfg.mu.Lock()
-	defer cfg.mu.Unlock()
-
-	val := cfg.get(key)
-	if val == nil {
-		return false
-	}
-
-	return cfg.checkZeroType(key, val, false).(bool)
+	return cfg.Snapshot().Bool(key)
 }
 
 // String returns the string value (or default) at `key`.
 // Note: This function might panic when they key does not exist and StrictnessPanic is used.
 // If an error happens it will return the zero value.
 func (cfg *Config) String(key string) string {
-	cfg.mu.Lock()
-	defer cfg.mu.Unlock()
-
-	val := cfg.get(key)
-	if val == nil {
-		return ""
-	}
-
-	return cfg.checkZeroType(key, val, "").(string)
+	return cfg.Snapshot().String(key)
 }
 
 // Int returns the int value (or default) at `key`.
 // Note: This function might panic when they key does not exist and StrictnessPanic is used.
 // If an error happens it will return the zero value.
 func (cfg *Config) Int(key string) int64 {
-	cfg.mu.Lock()
-	defer cfg.mu.Unlock()
-
-	val := cfg.get(key)
-	if val == nil {
-		return 0
-	}
-
-	return cfg.checkZeroType(key, val, int64(0)).(int64)
+	return cfg.Snapshot().Int(key)
 }
 
 // Float returns the float value (or default) at `key`.
 // Note: This function might panic when they key does not exist and StrictnessPanic is used.
 // If an error happens it will return the zero value.
 func (cfg *Config) Float(key string) float64 {
-	cfg.mu.Lock()
-	defer cfg.mu.Unlock()
-
-	val := cfg.get(key)
-	if val == nil {
-		return 0
-	}
-
-	return cfg.checkZeroType(key, val, float64(0)).(float64)
+	return cfg.Snapshot().Float(key)
 }
 
 // Duration returns the duration value (or default) at `key`.
 // Note: This function might panic when they key does not exist and StrictnessPanic is used.
 // If an error happens it will return the zero value.
 func (cfg *Config) Duration(key string) time.Duration {
-	cfg.mu.Lock()
-	defer cfg.mu.Unlock()
-
-	val := cfg.get(key)
-	if val == nil {
-		return time.Duration(0)
-	}
-
-	s := cfg.checkZeroType(key, val, "").(string)
-	d, err := time.ParseDuration(s)
-	if err != nil {
-		complain(
-			fmt.Sprintf("invalid duration: %v; use the duration validator!", s),
-			cfg.strictness,
-		)
-		return time.Duration(0)
-	}
-
-	return d
+	return cfg.Snapshot().Duration(key)
 }
 
 // Strings returns the string list value (or default) at `key`.
 // Note: This function might panic when they key does not exist and StrictnessPanic is used.
 // If an error happens it will return the zero value.
 func (cfg *Config) Strings(key string) []string {
-	cfg.mu.Lock()
-	defer cfg.mu.Unlock()
-
-	val := cfg.get(key)
-	if val == nil {
-		return nil
-	}
-
-	return cfg.checkZeroType(key, val, []string{}).([]string)
+	return cfg.Snapshot().Strings(key)
 }
 
 // Ints returns the int list value (or default) at `key`.
 // Note: This function might panic when they key does not exist and StrictnessPanic is used.
 // If an error happens it will return the zero value.
 func (cfg *Config) Ints(key string) []int64 {
-	cfg.mu.Lock()
-	defer cfg.mu.Unlock()
-
-	val := cfg.get(key)
-	if val == nil {
-		return nil
-	}
-
-	return cfg.checkZeroType(key, val, []int64{}).([]int64)
+	return cfg.Snapshot().Ints(key)
 }
 
 // Floats returns the float list value (or default) at `key`.
 // Note: This function might panic when they key does not exist and StrictnessPanic is used.
 // If an error happens it will return the zero value.
 func (cfg *Config) Floats(key string) []float64 {
-	cfg.mu.Lock()
-	defer cfg.mu.Unlock()
-
-	val := cfg.get(key)
-	if val == nil {
-		return nil
-	}
-
-	return cfg.checkZeroType(key, val, []float64{}).([]float64)
+	return cfg.Snapshot().Floats(key)
 }
 
 // Bools returns the boolean list value (or default) at `key`.
 // Note: This function might panic when they key does not exist and StrictnessPanic is used.
 // If an error happens it will return the zero value.
 func (cfg *Config) Bools(key string) []bool {
-	cfg.mu.Lock()
-	defer cfg.mu.Unlock()
-
-	val := cfg.get(key)
-	if val == nil {
-		return nil
-	}
-
-	return cfg.checkZeroType(key, val, []bool{}).([]bool)
+	return cfg.Snapshot().Bools(key)
 }
 
 // Durations returns the duration value (or default) at `key`.
 // Note: This function might panic when they key does not exist and StrictnessPanic is used.
 // If an error happens it will return the zero value.
 func (cfg *Config) Durations(key string) []time.Duration {
-	cfg.mu.Lock()
-	defer cfg.mu.Unlock()
-
-	val := cfg.get(key)
-	if val == nil {
-		return nil
-	}
-
-	strings := cfg.checkZeroType(key, val, []string{}).([]string)
-	durations := []time.Duration{}
-
-	for _, s := range strings {
-		d, err := time.ParseDuration(s)
-		if err != nil {
-			complain(
-				fmt.Sprintf("invalid duration: %v; use the durations validator!", s),
-				cfg.strictness,
-			)
-			return nil
-		}
-
-		durations = append(durations, d)
-	}
-
-	return durations
+	return cfg.Snapshot().Durations(key)
 }
 
 ////////////
@@ -1075,33 +1259,54 @@ func (cfg *Config) IsDefault(key string) bool {
 	cfg.mu.Lock()
 	defer cfg.mu.Unlock()
 
-	_, ok := cfg.defaultKeys[key]
+	_, ok := cfg.defaultKeys[prefixKey(cfg.section, key)]
 	return ok
 }
 
+// isExplicit returns true if `key` was set explicitly in this config,
+// i.e. it's neither taken over from the defaults nor missing at all.
+func (cfg *Config) isExplicit(key string) bool {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+
+	key = prefixKey(cfg.section, key)
+	if _, ok := cfg.state.lookup(key); !ok {
+		return false
+	}
+
+	_, isDefault := cfg.defaultKeys[key]
+	return !isDefault
+}
+
 // Merge takes all values from `other` that were set explicitly
 // and sets them in `cfg`. If any key changes, the respective
 // event callback will be called.
 func (cfg *Config) Merge(other *Config) error {
+	_, err := cfg.MergeWithReport(other)
+	return err
+}
+
+// MergeWithReport works like Merge(), but also returns which keys changed
+// and which of those need a restart of the application to take effect.
+func (cfg *Config) MergeWithReport(other *Config) (ChangeReport, error) {
+	if !reflect.DeepEqual(cfg.defaults, other.defaults) {
+		return ChangeReport{}, fmt.Errorf("refusing to merge configs with different defaults")
+	}
+
 	cfg.mu.Lock()
 
-	callbacks := []keyChangedEvent{}
+	events := []pendingEvent{}
 	defer func() {
 		// Call the callbacks without the lock:
-		for _, callback := range callbacks {
-			callback.fn(callback.key)
-		}
+		fireEvents(events)
 	}()
 
-	if !reflect.DeepEqual(cfg.defaults, other.defaults) {
-		return fmt.Errorf("refusing to merge configs with different defaults")
-	}
-
 	// NOTE: the unlock is called before the other defer!
 	defer cfg.mu.Unlock()
 
+	changes := []Change{}
 	for _, key := range cfg.keys() {
-		if _, ok := other.defaultKeys[key]; ok {
+		if _, ok := other.defaultKeys[prefixKey(cfg.section, key)]; ok {
 			// It is a default key on the other side.
 			// No need to set it, since we might have
 			// overwritten this key.
@@ -1113,13 +1318,40 @@ func (cfg *Config) Merge(other *Config) error {
 
 		// Only use callbacks if the key really changed:
 		if !reflect.DeepEqual(newVal, oldVal) {
-			callbacks = append(callbacks, cfg.gatherCallbacks(key)...)
-			parent, base := cfg.splitKey(key, false)
-			parent[base] = newVal
+			changes = append(changes, Change{
+				Key:    prefixKey(cfg.section, key),
+				Old:    oldVal,
+				New:    newVal,
+				Origin: OriginMerge,
+			})
 		}
 	}
 
-	return nil
+	merged := make(map[string]interface{})
+	for _, change := range changes {
+		merged[change.Key] = change.New
+	}
+
+	if err := cfg.checkConfigValidators(merged); err != nil {
+		return ChangeReport{}, e.Wrapf(err, "validate")
+	}
+
+	memory := cfg.state.load()
+	for _, change := range changes {
+		var err error
+		memory, err = setInMemory(memory, strings.Split(change.Key, "."), change.New)
+		if err != nil {
+			return ChangeReport{}, err
+		}
+	}
+
+	cfg.state.storeChanged(memory, merged)
+	for _, change := range changes {
+		delete(cfg.overrides, change.Key)
+		events = append(events, cfg.gatherCallbacks(change)...)
+	}
+
+	return cfg.newReport(changes), nil
 }
 
 ////////////
@@ -1208,9 +1440,9 @@ func (cfg *Config) GetDefault(key string) DefaultEntry {
 	// The lock here is probably not necessary,
 	// since we wont't modify defaults.
 	key = prefixKey(cfg.section, key)
-	entry := getDefaultByKey(key, cfg.defaults, cfg.strictness)
+	entry := cfg.index.entry(key)
 	if entry == nil {
-		complain(fmt.Sprintf("bug: invalid config key: %v", key), cfg.strictness)
+		cfg.invalidKey(key)
 		return DefaultEntry{}
 	}
 
@@ -1227,7 +1459,7 @@ func (cfg *Config) Keys() []string {
 
 func (cfg *Config) keys() []string {
 	allKeys := []string{}
-	err := keys(cfg.memory, nil, func(section map[interface{}]interface{}, key []string) error {
+	err := keys(cfg.state.load(), nil, func(section map[interface{}]interface{}, key []string) error {
 		fullKey := strings.Join(key, ".")
 		if strings.HasPrefix(fullKey, cfg.section) {
 			if len(cfg.section) != 0 {
@@ -1243,7 +1475,10 @@ func (cfg *Config) keys() []string {
 		// keys() should only return an error if the function passed to it
 		// error in some way. Since we don't do that it should not produce
 		// any non-nil error return.
-		complain(fmt.Sprintf("Keys() failed internally: %v", err), cfg.strictness)
+		complain(Complaint{
+			Kind: ComplaintInternal,
+			Msg:  fmt.Sprintf("Keys() failed internally: %v", err),
+		}, cfg.strictness)
 		return nil
 	}
 
@@ -1263,11 +1498,17 @@ func (cfg *Config) Section(section string) *Config {
 		callbackCount: cfg.callbackCount,
 		// The data is shared, any set to a section will cause a set in the parent.
 		defaults: cfg.defaults,
-		memory:   cfg.memory,
+		index:    cfg.index,
+		state:    cfg.state,
+		started:  cfg.started,
 		// Sections may have own callbacks.
 		// The parent callbacks are still called though.
+		// The ids of those have to be unique over all sections.
 		changeCallbacks: cfg.changeCallbacks,
+		defaultKeys:     cfg.defaultKeys,
 		strictness:      cfg.strictness,
+		overrides:       cfg.overrides,
+		keyChecks:       cfg.keyChecks,
 	}
 }
 
@@ -1278,7 +1519,7 @@ func (cfg *Config) IsValidKey(key string) bool {
 	defer cfg.mu.Unlock()
 
 	key = prefixKey(cfg.section, key)
-	return getDefaultByKey(key, cfg.defaults, cfg.strictness) != nil
+	return cfg.index.entry(key) != nil
 }
 
 const sliceSeparator = " ;; "
@@ -1344,15 +1585,34 @@ func (cfg *Config) Cast(key, val string) (interface{}, error) {
 	cfg.mu.Lock()
 	defer cfg.mu.Unlock()
 
+	return cfg.cast(key, val)
+}
+
+// cast is the worker behind Cast(). Call with cfg.mu locked.
+func (cfg *Config) cast(key, val string) (interface{}, error) {
 	key = prefixKey(cfg.section, key)
-	entry := getDefaultByKey(key, cfg.defaults, cfg.strictness)
+	entry := cfg.index.entry(key)
 	if entry == nil {
-		msg := fmt.Sprintf("bug: invalid config key: %v", key)
-		complain(msg, cfg.strictness)
-		return nil, errors.New(msg)
+		return nil, cfg.invalidKey(key)
 	}
 
-	switch entry.Default.(type) {
+	parsed, err := castValue(entry.Default, val)
+	if err != nil {
+		return nil, &ValidationError{
+			Key:   key,
+			Value: val,
+			Want:  getTypeOf(entry.Default),
+			Got:   "string",
+			Err:   err,
+		}
+	}
+
+	return parsed, nil
+}
+
+// castValue parses `val` as the type of `def`.
+func castValue(def interface{}, val string) (interface{}, error) {
+	switch def.(type) {
 	case int, int16, int32, int64, uint, uint16, uint32, uint64:
 		return strconv.ParseInt(val, 10, 64)
 	case float32, float64:
@@ -1386,10 +1646,9 @@ func (cfg *Config) Uncast(key string) string {
 	defer cfg.mu.Unlock()
 
 	fullKey := prefixKey(cfg.section, key)
-	entry := getDefaultByKey(fullKey, cfg.defaults, cfg.strictness)
+	entry := cfg.index.entry(fullKey)
 	if entry == nil {
-		msg := fmt.Sprintf("bug: invalid config key: %v", fullKey)
-		complain(msg, cfg.strictness)
+		cfg.invalidKey(fullKey)
 		return ""
 	}
 
@@ -1442,44 +1701,96 @@ func (cfg *Config) Version() Version {
 func (cfg *Config) Reset(key string) error {
 	cfg.mu.Lock()
 
-	key = prefixKey(cfg.section, key)
-	entry := getDefaultByKey(key, cfg.defaults, cfg.strictness)
+	fullKey := prefixKey(cfg.section, key)
+	entry := cfg.index.entry(fullKey)
 	if entry != nil {
 		// Key points to a value.
-		cfg.defaults[key] = struct{}{}
 		cfg.mu.Unlock()
-		return cfg.setLocked(key, entry.Default)
+
+		def, err := generalizeType(maybeMakeInterfaceList(entry.Default), getTypeOf(entry.Default))
+		if err != nil {
+			return err
+		}
+
+		if err := cfg.setWithOrigin(key, def, OriginReset); err != nil {
+			return err
+		}
+
+		cfg.mu.Lock()
+		defer cfg.mu.Unlock()
+
+		cfg.defaultKeys[fullKey] = struct{}{}
+		return nil
 	}
 
+	events := []pendingEvent{}
+	defer func() {
+		// Call the callbacks without the lock:
+		fireEvents(events)
+	}()
+
+	// NOTE: the unlock is called before the other defer!
 	defer cfg.mu.Unlock()
 
+	oldMemory := cfg.state.load()
+	if err := cfg.resetSection(fullKey); err != nil {
+		return err
+	}
+
+	events = cfg.gatherChanges(oldMemory, cfg.state.load(), OriginReset)
+	return nil
+}
+
+// resetSection is the worker behind Reset() for sections.
+// Call with cfg.mu locked.
+func (cfg *Config) resetSection(key string) error {
 	if key == "" {
-		// The whole config needs to be reset:
-		cfg.memory = make(map[interface{}]interface{})
-		return mergeDefaults(cfg.memory, cfg.defaults, cfg.defaultKeys, cfg.section)
+		// The whole config needs to be reset.
+		for defaultKey := range cfg.defaultKeys {
+			delete(cfg.defaultKeys, defaultKey)
+		}
+
+		cfg.clearOverrides()
+
+		memory := make(map[interface{}]interface{})
+		if err := mergeDefaults(memory, cfg.defaults, cfg.defaultKeys, ""); err != nil {
+			return err
+		}
+
+		cfg.state.store(memory)
+		return nil
 	}
 
 	// We need to clear a section:
 	splitKey := strings.Split(key, ".")
-	defaultSection := getDefaultSectionByKeys(
-		splitKey[:len(splitKey)-1],
-		cfg.defaults,
-		cfg.strictness,
-	)
-
+	parentKey := strings.Join(splitKey[:len(splitKey)-1], ".")
+	defaultSection := cfg.index.section(parentKey)
 	if defaultSection == nil {
-		msg := fmt.Sprintf("no such section: %v", key)
-		complain(msg, cfg.strictness)
-		return errors.New(msg)
+		return cfg.invalidKey(key)
 	}
 
 	parent, base := cfg.splitKey(key, true)
 	if parent == nil {
-		msg := fmt.Sprintf("bug: invalid config key: %v", key)
-		complain(msg, cfg.strictness)
-		return errors.New(msg)
+		return cfg.invalidKey(key)
 	}
 
+	// mergeDefaults() modifies the sections, so we need our own copy:
+	parent = copyMemory(parent)
 	delete(parent, base)
-	return mergeDefaults(parent, defaultSection, cfg.defaultKeys, cfg.section)
+
+	if err := mergeDefaults(parent, defaultSection, cfg.defaultKeys, parentKey); err != nil {
+		return err
+	}
+
+	memory := parent
+	if parentKey != "" {
+		var err error
+		memory, err = setInMemory(cfg.state.load(), splitKey[:len(splitKey)-1], parent)
+		if err != nil {
+			return err
+		}
+	}
+
+	cfg.state.store(memory)
+	return nil
 }
@@ -191,6 +191,66 @@ func TestAddChangeSignalAll(t *testing.T) {
 	require.Equal(t, 2, callCount)
 }
 
+func TestAddChangeSignalAllGetsKey(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	keys := []string{}
+	cfg.AddEvent("", func(key string) {
+		keys = append(keys, key)
+	})
+
+	require.Nil(t, cfg.SetInt("daemon.port", 42))
+	require.Nil(t, cfg.SetString("data.ipfs.path", "new-value"))
+	require.Equal(t, []string{"daemon.port", "data.ipfs.path"}, keys)
+}
+
+func TestIsDefaultSection(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	fsSec := cfg.Section("fs")
+	require.True(t, fsSec.IsDefault("compress.default_algo"))
+	require.False(t, cfg.Section("daemon").IsDefault("port"))
+
+	require.Nil(t, fsSec.SetString("compress.default_algo", "lz4"))
+	require.False(t, fsSec.IsDefault("compress.default_algo"))
+	require.False(t, cfg.IsDefault("fs.compress.default_algo"))
+}
+
+func TestReloadUpdatesDefaultKeys(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+	require.False(t, cfg.IsDefault("daemon.port"))
+	require.True(t, cfg.IsDefault("fs.compress.default_algo"))
+
+	newConfig := "fs:\n  compress:\n    default_algo: lz4\n"
+	require.Nil(t, cfg.Reload(NewYamlDecoder(strings.NewReader(newConfig))))
+	require.True(t, cfg.IsDefault("daemon.port"))
+	require.False(t, cfg.IsDefault("fs.compress.default_algo"))
+}
+
+func TestResetValueInSection(t *testing.T) {
+	defaults := DefaultMapping{
+		"daemon": DefaultMapping{
+			"port": DefaultEntry{
+				Default: 6666,
+			},
+		},
+	}
+
+	cfg, err := openFromString("daemon:\n  port: 7777\n", defaults)
+	require.Nil(t, err)
+
+	daemon := cfg.Section("daemon")
+	require.Nil(t, daemon.Reset("port"))
+	require.Equal(t, int64(6666), daemon.Int("port"))
+	require.True(t, daemon.IsDefault("port"))
+
+	// Reset must not modify the defaults:
+	require.Len(t, defaults, 1)
+}
+
 func TestOpenSave(t *testing.T) {
 	cfg, err := openFromString(testConfig, TestDefaults)
 	require.Nil(t, err)
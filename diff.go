@@ -0,0 +1,104 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Diff returns the changes needed to turn `a` into `b`, sorted by key.
+// Both configs should use the same defaults; if they are sections, the keys
+// are relative to their section.
+//
+// Keys that exist only in `b` (e.g. a new section below __many__) are
+// reported as ChangeAdded, keys that exist only in `a` as ChangeRemoved.
+// For those the value of the missing side is the default of the key, just
+// like the getters would return it. Keys with NeedsRestart set in their
+// default entry are flagged. The Origin of the changes is not meaningful.
+//
+// Diff can be used to preview what a Reload() or Merge() would do:
+//
+//	newCfg, err := config.Open(dec, defaults, config.StrictnessPanic)
+//	// handle err...
+//	for _, change := range config.Diff(cfg, newCfg) {
+//		fmt.Println(change)
+//	}
+func Diff(a, b *Config) []Change {
+	return a.diffValues(
+		a.sectionValues(a.state.snapshot()),
+		b.sectionValues(b.state.snapshot()),
+	)
+}
+
+// diffValues is the worker behind Diff(). The keys of `aFlat` and `bFlat`
+// are relative to the section of `cfg`, which is used to look up defaults.
+func (cfg *Config) diffValues(aFlat, bFlat map[string]interface{}) []Change {
+	allKeys := []string{}
+	for key := range aFlat {
+		allKeys = append(allKeys, key)
+	}
+
+	for key := range bFlat {
+		if _, ok := aFlat[key]; !ok {
+			allKeys = append(allKeys, key)
+		}
+	}
+
+	sort.Strings(allKeys)
+
+	changes := []Change{}
+	for _, key := range allKeys {
+		oldVal, inA := aFlat[key]
+		newVal, inB := bFlat[key]
+
+		kind := ChangeModified
+		switch {
+		case !inA:
+			kind = ChangeAdded
+			oldVal = cfg.defaultValue(key)
+		case !inB:
+			kind = ChangeRemoved
+			newVal = cfg.defaultValue(key)
+		case reflect.DeepEqual(oldVal, newVal):
+			continue
+		}
+
+		changes = append(changes, Change{
+			Key:          key,
+			Old:          oldVal,
+			New:          newVal,
+			Kind:         kind,
+			NeedsRestart: cfg.needsRestart(prefixKey(cfg.section, key)),
+		})
+	}
+
+	return changes
+}
+
+// sectionValues returns all values in `snap`,
+// with their keys relative to the section of `cfg`.
+func (cfg *Config) sectionValues(snap *memorySnapshot) map[string]interface{} {
+	values := snap.values
+	if cfg.section == "" {
+		return values
+	}
+
+	relative := make(map[string]interface{})
+	for key, val := range values {
+		if isInSection(key, cfg.section) {
+			relative[strings.TrimPrefix(key, cfg.section+".")] = val
+		}
+	}
+
+	return relative
+}
+
+// defaultValue returns the default of the `key` relative to the section
+// of `cfg` or nil if there is no such key.
+func (cfg *Config) defaultValue(key string) interface{} {
+	if entry := cfg.index.entry(prefixKey(cfg.section, key)); entry != nil {
+		return entry.Default
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffModified(t *testing.T) {
+	a, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	b, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	require.Empty(t, Diff(a, b))
+
+	require.Nil(t, b.SetInt("daemon.port", 7777))
+	require.Nil(t, b.SetString("fs.compress.default_algo", "lz4"))
+
+	changes := Diff(a, b)
+	require.Equal(t, []Change{{
+		Key:          "daemon.port",
+		Old:          int64(6667),
+		New:          int64(7777),
+		Kind:         ChangeModified,
+		NeedsRestart: true,
+	}, {
+		Key:  "fs.compress.default_algo",
+		Old:  "snappy",
+		New:  "lz4",
+		Kind: ChangeModified,
+	}}, changes)
+
+	require.Equal(t, "daemon.port: 6667 -> 7777 (requires restart)", changes[0].String())
+	require.Equal(t, "fs.compress.default_algo: snappy -> lz4", changes[1].String())
+
+	// Sections only see their own keys:
+	changes = Diff(a.Section("daemon"), b.Section("daemon"))
+	require.Len(t, changes, 1)
+	require.Equal(t, "port", changes[0].Key)
+}
+
+func TestDiffMany(t *testing.T) {
+	a, err := Open(NewYamlDecoder(strings.NewReader(`mounts:
+  music:
+    path: /music
+  videos:
+    path: /videos
+`)), testManyDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	b, err := Open(NewYamlDecoder(strings.NewReader(`mounts:
+  music:
+    path: /data/music
+  photos:
+    path: /photos
+`)), testManyDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	changes := Diff(a, b)
+	require.Equal(t, []Change{{
+		Key:  "mounts.music.path",
+		Old:  "/music",
+		New:  "/data/music",
+		Kind: ChangeModified,
+	}, {
+		Key:  "mounts.photos.options.read_only",
+		Old:  false,
+		New:  false,
+		Kind: ChangeAdded,
+	}, {
+		Key:  "mounts.photos.path",
+		Old:  "",
+		New:  "/photos",
+		Kind: ChangeAdded,
+	}, {
+		Key:  "mounts.videos.options.read_only",
+		Old:  false,
+		New:  false,
+		Kind: ChangeRemoved,
+	}, {
+		Key:  "mounts.videos.path",
+		Old:  "/videos",
+		New:  "",
+		Kind: ChangeRemoved,
+	}}, changes)
+
+	require.Equal(t, "mounts.photos.path: added (/photos)", changes[2].String())
+	require.Equal(t, "mounts.videos.path: removed (was /videos)", changes[4].String())
+}
+
+func TestChangeEventKind(t *testing.T) {
+	cfg, err := Open(nil, testManyDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	changes := []Change{}
+	cfg.AddChangeEvent("", func(change Change) {
+		changes = append(changes, change)
+	})
+
+	require.Nil(t, cfg.SetString("mounts.music.path", "/music"))
+	require.Nil(t, cfg.SetString("mounts.music.path", "/data/music"))
+	require.Nil(t, cfg.Reload(nil))
+
+	kinds := []ChangeKind{}
+	for _, change := range changes {
+		kinds = append(kinds, change.Kind)
+	}
+
+	require.Equal(t, []ChangeKind{ChangeAdded, ChangeModified, ChangeRemoved}, kinds)
+}
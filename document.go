@@ -0,0 +1,583 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"sync"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// YamlDocument remembers the layout of a YAML file it decoded.  When saving a
+// config through the Encoder of the same document, only the values that
+// actually changed are updated. Comments, the order of keys and anchors are
+// kept the way the user wrote them. Keys that were set since are appended to
+// their section; keys that only have their default value are not written.
+//
+// Typical usage looks like this:
+//
+//	doc := NewYamlDocument()
+//	cfg, err := Open(doc.Decoder(r), defaults, StrictnessPanic)
+//	// ... modify cfg ...
+//	err = cfg.Save(doc.Encoder(w))
+//
+// A YamlDocument may be used by several go routines.
+type YamlDocument struct {
+	mu   sync.Mutex
+	root *yamlv3.Node
+}
+
+// NewYamlDocument returns a new, empty document.
+// Encoding an empty document works like the plain YAML encoder.
+func NewYamlDocument() *YamlDocument {
+	return &YamlDocument{}
+}
+
+// Decoder returns a Decoder that reads the YAML data in `r`
+// and remembers its layout for subsequent calls to Encode.
+func (doc *YamlDocument) Decoder(r io.Reader) Decoder {
+	return &yamlDocumentDecoder{doc: doc, r: r}
+}
+
+// Encoder returns an Encoder that writes the remembered layout
+// to `w`, updated with the values of the config.
+func (doc *YamlDocument) Encoder(w io.Writer) Encoder {
+	return &yamlDocumentEncoder{doc: doc, w: w}
+}
+
+////////////
+
+type yamlDocumentDecoder struct {
+	doc       *YamlDocument
+	r         io.Reader
+	positions map[string]Position
+}
+
+func (dd *yamlDocumentDecoder) Positions() map[string]Position {
+	return dd.positions
+}
+
+func (dd *yamlDocumentDecoder) Decode() (Version, map[interface{}]interface{}, error) {
+	data, err := ioutil.ReadAll(dd.r)
+	if err != nil {
+		return Version(-1), nil, err
+	}
+
+	// The values are read exactly like the normal decoder does,
+	// the node tree is only needed to remember the layout.
+	version, memory, err := NewYamlDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		return Version(-1), nil, err
+	}
+
+	root := &yamlv3.Node{}
+	if err := yamlv3.Unmarshal(data, root); err != nil {
+		return Version(-1), nil, err
+	}
+
+	dd.positions = make(map[string]Position)
+	yamlPositions(root, readerName(dd.r), "", dd.positions)
+
+	dd.doc.mu.Lock()
+	defer dd.doc.mu.Unlock()
+
+	if root.Kind == yamlv3.DocumentNode {
+		dd.doc.root = root
+	} else {
+		// Empty input, start from scratch on Encode.
+		dd.doc.root = nil
+	}
+
+	return version, memory, nil
+}
+
+////////////
+
+type yamlDocumentEncoder struct {
+	doc         *YamlDocument
+	w           io.Writer
+	defaultKeys map[string]struct{}
+}
+
+func (de *yamlDocumentEncoder) SetDefaultKeys(keys map[string]struct{}) {
+	de.defaultKeys = keys
+}
+
+func (de *yamlDocumentEncoder) Encode(version Version, memory map[interface{}]interface{}) error {
+	de.doc.mu.Lock()
+	defer de.doc.mu.Unlock()
+
+	// Without a document to update, all keys are written:
+	defaultKeys := de.defaultKeys
+	if de.doc.root == nil || len(de.doc.root.Content) == 0 {
+		defaultKeys = nil
+		de.doc.root = &yamlv3.Node{
+			Kind:    yamlv3.DocumentNode,
+			Content: []*yamlv3.Node{{Kind: yamlv3.MappingNode, Tag: "!!map"}},
+		}
+	}
+
+	mapping := de.doc.root.Content[0]
+	if mapping.Kind != yamlv3.MappingNode {
+		// Something odd like a scalar document. Nothing to preserve here.
+		mapping.Kind = yamlv3.MappingNode
+		mapping.Tag = "!!map"
+		mapping.Value = ""
+		mapping.Content = nil
+	}
+
+	up := &yamlUpdater{
+		updated:     make(map[*yamlv3.Node]bool),
+		defaultKeys: defaultKeys,
+	}
+
+	if err := up.updateMapping(mapping, memory, ""); err != nil {
+		return err
+	}
+
+	up.apply()
+
+	buf := &bytes.Buffer{}
+	enc := yamlv3.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(de.doc.root); err != nil {
+		return err
+	}
+
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	_, err := de.w.Write(replaceVersionHeader(buf.Bytes(), version))
+	return err
+}
+
+// replaceVersionHeader makes sure that the first line of `data`
+// is an up-to-date version tag.
+func replaceVersionHeader(data []byte, version Version) []byte {
+	header := []byte(fmt.Sprintf(
+		"# version: %d (DO NOT MODIFY THIS LINE)\n",
+		version,
+	))
+
+	if versionTag.Match(data) {
+		if idx := bytes.IndexByte(data, '\n'); idx >= 0 {
+			data = data[idx+1:]
+		} else {
+			data = nil
+		}
+	}
+
+	return append(header, data...)
+}
+
+////////////
+
+// yamlUpdater collects all modifications before applying them.
+// This way all comparisons are done against the unmodified tree,
+// which matters when several keys share the same anchored node.
+type yamlUpdater struct {
+	// nodes that will be overwritten with the respective replacement:
+	replacements []yamlReplacement
+	updated      map[*yamlv3.Node]bool
+
+	// references (aliases, merged keys) that should keep their old value:
+	kept []yamlKeptRef
+
+	// mappings that need to get rid of some of their keys:
+	removals []yamlRemoval
+
+	// full keys that were not set and are not appended therefore:
+	defaultKeys map[string]struct{}
+}
+
+type yamlReplacement struct {
+	node, with *yamlv3.Node
+}
+
+type yamlKeptRef struct {
+	// target is the node the reference currently points to.
+	target *yamlv3.Node
+	// pristine is a copy of target, made before any modification.
+	pristine *yamlv3.Node
+	// fix is called with `pristine` if target changed after all.
+	fix func(pristine *yamlv3.Node)
+}
+
+type yamlRemoval struct {
+	mapping *yamlv3.Node
+	keep    map[string]bool
+}
+
+func resolveAlias(node *yamlv3.Node) *yamlv3.Node {
+	for node != nil && node.Kind == yamlv3.AliasNode {
+		node = node.Alias
+	}
+
+	return node
+}
+
+func copyYamlNode(node *yamlv3.Node) *yamlv3.Node {
+	cp := *node
+	cp.Anchor = ""
+	cp.Content = make([]*yamlv3.Node, 0, len(node.Content))
+	for _, child := range node.Content {
+		cp.Content = append(cp.Content, copyYamlNode(child))
+	}
+
+	return &cp
+}
+
+func newYamlKey(key string) *yamlv3.Node {
+	return &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key}
+}
+
+func newYamlValue(val interface{}) (*yamlv3.Node, error) {
+	node := &yamlv3.Node{}
+	if err := node.Encode(val); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+// findYamlKey returns the value node of `key` in `mapping`.
+// If the key is only available through a merge key (<<),
+// direct will be false.
+func findYamlKey(mapping *yamlv3.Node, key string) (value *yamlv3.Node, direct bool) {
+	merges := []*yamlv3.Node{}
+	for idx := 0; idx+1 < len(mapping.Content); idx += 2 {
+		keyNode, valNode := mapping.Content[idx], mapping.Content[idx+1]
+		if keyNode.Value == key {
+			return valNode, true
+		}
+
+		if keyNode.Tag == "!!merge" || keyNode.Value == "<<" {
+			merges = append(merges, valNode)
+		}
+	}
+
+	for _, merge := range merges {
+		merge = resolveAlias(merge)
+		sources := []*yamlv3.Node{merge}
+		if merge.Kind == yamlv3.SequenceNode {
+			sources = merge.Content
+		}
+
+		for _, source := range sources {
+			source = resolveAlias(source)
+			if source.Kind != yamlv3.MappingNode {
+				continue
+			}
+
+			if value, _ := findYamlKey(source, key); value != nil {
+				return value, false
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// numericValue returns `val` as float64, if it is a number.
+func numericValue(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	return 0, false
+}
+
+func normalizeValue(val interface{}) (interface{}, error) {
+	return generalizeType(maybeMakeInterfaceList(val), getTypeOf(val))
+}
+
+// yamlNodeEquals checks if `node` would decode to `val`.
+func yamlNodeEquals(node *yamlv3.Node, val interface{}) bool {
+	node = resolveAlias(node)
+
+	if section, ok := val.(map[interface{}]interface{}); ok {
+		if node.Kind != yamlv3.MappingNode {
+			return false
+		}
+
+		for keyVal, child := range section {
+			key, ok := keyVal.(string)
+			if !ok {
+				return false
+			}
+
+			childNode, _ := findYamlKey(node, key)
+			if childNode == nil || !yamlNodeEquals(childNode, child) {
+				return false
+			}
+		}
+
+		for idx := 0; idx+1 < len(node.Content); idx += 2 {
+			key := node.Content[idx].Value
+			if _, ok := section[key]; !ok && key != "<<" {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	var decoded interface{}
+	if err := node.Decode(&decoded); err != nil {
+		return false
+	}
+
+	if decoded == nil || val == nil {
+		return decoded == nil && val == nil
+	}
+
+	want, err := normalizeValue(val)
+	if err != nil {
+		return false
+	}
+
+	got, err := generalizeType(decoded, getTypeOf(want))
+	if err != nil {
+		return false
+	}
+
+	// 3 and 3.0 are the same for our purposes:
+	if wantNum, ok := numericValue(want); ok {
+		gotNum, ok := numericValue(got)
+		return ok && gotNum == wantNum
+	}
+
+	return reflect.DeepEqual(want, got)
+}
+
+func (up *yamlUpdater) replace(node, with *yamlv3.Node) {
+	// Keep the decorations of the old node:
+	with.HeadComment = node.HeadComment
+	with.LineComment = node.LineComment
+	with.FootComment = node.FootComment
+	if node.Kind != yamlv3.AliasNode {
+		with.Anchor = node.Anchor
+	}
+
+	if node.Kind == with.Kind {
+		switch with.Kind {
+		case yamlv3.ScalarNode:
+			if with.Tag == "!!str" && node.ShortTag() == "!!str" {
+				with.Style = node.Style
+			}
+		case yamlv3.SequenceNode, yamlv3.MappingNode:
+			with.Style = node.Style
+		}
+	}
+
+	up.replacements = append(up.replacements, yamlReplacement{node: node, with: with})
+	up.updated[node] = true
+}
+
+func (up *yamlUpdater) keep(target *yamlv3.Node, fix func(pristine *yamlv3.Node)) {
+	up.kept = append(up.kept, yamlKeptRef{
+		target:   target,
+		pristine: copyYamlNode(target),
+		fix:      fix,
+	})
+}
+
+func appendYamlPair(mapping *yamlv3.Node, key string, value *yamlv3.Node) {
+	mapping.Content = append(mapping.Content, newYamlKey(key), value)
+}
+
+func (up *yamlUpdater) updateMapping(mapping *yamlv3.Node, section map[interface{}]interface{}, prefix string) error {
+	sectionKeys := []string{}
+	keep := make(map[string]bool)
+	for keyVal := range section {
+		key, ok := keyVal.(string)
+		if !ok {
+			return fmt.Errorf("config contains non string keys: %v", keyVal)
+		}
+
+		sectionKeys = append(sectionKeys, key)
+		keep[key] = true
+	}
+
+	sort.Strings(sectionKeys)
+	up.removals = append(up.removals, yamlRemoval{mapping: mapping, keep: keep})
+
+	for _, key := range sectionKeys {
+		val := section[key]
+		valNode, direct := findYamlKey(mapping, key)
+
+		if valNode == nil {
+			// A key that was not written down by the user yet:
+			if val = up.withoutDefaults(prefixKey(prefix, key), val); val == nil {
+				continue
+			}
+
+			newNode, err := newYamlValue(val)
+			if err != nil {
+				return err
+			}
+
+			appendYamlPair(mapping, key, newNode)
+			continue
+		}
+
+		if childSection, ok := val.(map[interface{}]interface{}); ok {
+			target := resolveAlias(valNode)
+			if target.Kind != yamlv3.MappingNode {
+				newNode, err := newYamlValue(val)
+				if err != nil {
+					return err
+				}
+
+				if direct {
+					up.replace(valNode, newNode)
+				} else {
+					appendYamlPair(mapping, key, newNode)
+				}
+
+				continue
+			}
+
+			if direct && valNode.Kind != yamlv3.AliasNode {
+				if err := up.updateMapping(target, childSection, prefixKey(prefix, key)); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// The section is shared with others; modifying it in place
+			// would modify the others too. Make it a real section.
+			if !yamlNodeEquals(target, childSection) {
+				cp := copyYamlNode(target)
+				if direct {
+					up.replace(valNode, cp)
+				} else {
+					appendYamlPair(mapping, key, cp)
+				}
+
+				if err := up.updateMapping(cp, childSection, prefixKey(prefix, key)); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			up.keepRef(mapping, key, valNode, direct)
+			continue
+		}
+
+		if yamlNodeEquals(valNode, val) {
+			up.keepRef(mapping, key, valNode, direct)
+			continue
+		}
+
+		newNode, err := newYamlValue(val)
+		if err != nil {
+			return err
+		}
+
+		if direct {
+			up.replace(valNode, newNode)
+		} else {
+			appendYamlPair(mapping, key, newNode)
+		}
+	}
+
+	return nil
+}
+
+// withoutDefaults returns `val` (found at the full `key`) without the keys
+// that still have their default value, or nil if nothing is left of it.
+func (up *yamlUpdater) withoutDefaults(key string, val interface{}) interface{} {
+	section, ok := val.(map[interface{}]interface{})
+	if !ok {
+		if _, isDefault := up.defaultKeys[key]; isDefault {
+			return nil
+		}
+
+		return val
+	}
+
+	result := make(map[interface{}]interface{})
+	for childKey, child := range section {
+		if name, ok := childKey.(string); ok {
+			child = up.withoutDefaults(prefixKey(key, name), child)
+		}
+
+		if child != nil {
+			result[childKey] = child
+		}
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+
+	return result
+}
+
+// keepRef remembers that `key` should keep its current value, even
+// if the node it refers to (through an alias or merge) is modified.
+func (up *yamlUpdater) keepRef(mapping *yamlv3.Node, key string, valNode *yamlv3.Node, direct bool) {
+	if direct && valNode.Kind != yamlv3.AliasNode {
+		// Nothing shared; nothing can modify it.
+		return
+	}
+
+	up.keep(resolveAlias(valNode), func(pristine *yamlv3.Node) {
+		if direct {
+			up.replace(valNode, pristine)
+			return
+		}
+
+		appendYamlPair(mapping, key, pristine)
+	})
+}
+
+func (up *yamlUpdater) isModified(node *yamlv3.Node) bool {
+	if up.updated[node] {
+		return true
+	}
+
+	for _, child := range node.Content {
+		if up.isModified(child) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (up *yamlUpdater) apply() {
+	// Check before anything is modified, since this might add replacements:
+	for _, ref := range up.kept {
+		if up.isModified(ref.target) {
+			ref.fix(ref.pristine)
+		}
+	}
+
+	for _, repl := range up.replacements {
+		*repl.node = *repl.with
+	}
+
+	for _, removal := range up.removals {
+		content := removal.mapping.Content[:0]
+		for idx := 0; idx+1 < len(removal.mapping.Content); idx += 2 {
+			keyNode := removal.mapping.Content[idx]
+			if keyNode.Value == "<<" || removal.keep[keyNode.Value] {
+				content = append(content, keyNode, removal.mapping.Content[idx+1])
+			}
+		}
+
+		removal.mapping.Content = content
+	}
+}
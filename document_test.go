@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestYamlDocumentKeepsComments(t *testing.T) {
+	text := `# version: 1 (DO NOT MODIFY THIS LINE)
+# The daemon section:
+daemon:
+  # The port to listen on.
+  port: 6667 # not 6666!
+# Where ipfs lives:
+data:
+  ipfs:
+    path: x
+`
+
+	doc := NewYamlDocument()
+	cfg, err := Open(doc.Decoder(strings.NewReader(text)), TestDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	require.Nil(t, cfg.SetInt("daemon.port", 7000))
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, cfg.Save(doc.Encoder(buf)))
+
+	out := buf.String()
+	require.True(t, strings.HasPrefix(out, "# version: 1 (DO NOT MODIFY THIS LINE)\n"))
+	require.Contains(t, out, "# The daemon section:\n")
+	require.Contains(t, out, "  # The port to listen on.\n  port: 7000 # not 6666!\n")
+	require.Contains(t, out, "# Where ipfs lives:\n")
+
+	// daemon was written first, so it should stay that way:
+	require.True(t, strings.Index(out, "daemon:") < strings.Index(out, "data:"))
+
+	// Keys that only have their default are not appended:
+	require.NotContains(t, out, "default_algo")
+	require.NotContains(t, out, "repo:")
+
+	newCfg, err := Open(NewYamlDecoder(buf), TestDefaults, StrictnessPanic)
+	require.Nil(t, err)
+	configMustEquals(t, cfg, newCfg)
+}
+
+func TestYamlDocumentAppendsSetKeys(t *testing.T) {
+	text := "# version: 0 (DO NOT MODIFY THIS LINE)\ndaemon:\n  port: 6667\n"
+
+	doc := NewYamlDocument()
+	cfg, err := Open(doc.Decoder(strings.NewReader(text)), TestDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	require.Nil(t, cfg.SetInt("daemon.port", 7000))
+	require.Nil(t, cfg.SetString("fs.compress.default_algo", "lz4"))
+	_, err = cfg.applyEnv([]string{"APP_DATA_IPFS_PATH=/ipfs"}, "APP", "_")
+	require.Nil(t, err)
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, cfg.Save(doc.Encoder(buf)))
+	require.Equal(t, `# version: 0 (DO NOT MODIFY THIS LINE)
+daemon:
+  port: 7000
+fs:
+  compress:
+    default_algo: lz4
+`, buf.String())
+}
+
+func TestYamlDocumentUnchanged(t *testing.T) {
+	defaults := DefaultMapping{
+		"a": DefaultEntry{
+			Default: 1.0,
+		},
+		"b": DefaultEntry{
+			Default: []string{},
+		},
+	}
+
+	text := `# version: 0 (DO NOT MODIFY THIS LINE)
+b: ['x', 'y'] # flow style
+a: 2.0
+`
+
+	doc := NewYamlDocument()
+	cfg, err := Open(doc.Decoder(strings.NewReader(text)), defaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, cfg.Save(doc.Encoder(buf)))
+	require.Equal(t, text, buf.String())
+}
+
+func TestYamlDocumentAnchors(t *testing.T) {
+	defaults := DefaultMapping{
+		"mounts": DefaultMapping{
+			"__many__": DefaultMapping{
+				"path": DefaultEntry{
+					Default: "",
+				},
+				"read_only": DefaultEntry{
+					Default: false,
+				},
+			},
+		},
+	}
+
+	text := `# version: 0 (DO NOT MODIFY THIS LINE)
+mounts:
+  base: &base
+    path: /base
+    read_only: true
+  other:
+    <<: *base
+    path: /other
+  copy: *base
+`
+
+	doc := NewYamlDocument()
+	cfg, err := Open(doc.Decoder(strings.NewReader(text)), defaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	require.Equal(t, true, cfg.Bool("mounts.other.read_only"))
+	require.Equal(t, "/base", cfg.String("mounts.copy.path"))
+
+	// Modifying the anchor should not modify the ones referencing it:
+	require.Nil(t, cfg.SetBool("mounts.base.read_only", false))
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, cfg.Save(doc.Encoder(buf)))
+	require.Contains(t, buf.String(), "base: &base")
+
+	newCfg, err := Open(NewYamlDecoder(bytes.NewReader(buf.Bytes())), defaults, StrictnessPanic)
+	require.Nil(t, err)
+	configMustEquals(t, cfg, newCfg)
+
+	require.Equal(t, false, newCfg.Bool("mounts.base.read_only"))
+	require.Equal(t, true, newCfg.Bool("mounts.other.read_only"))
+	require.Equal(t, true, newCfg.Bool("mounts.copy.read_only"))
+}
+
+func TestYamlDocumentRemovedSection(t *testing.T) {
+	defaults := DefaultMapping{
+		"a": DefaultMapping{
+			"__many__": DefaultMapping{
+				"val": DefaultEntry{
+					Default: 1,
+				},
+			},
+		},
+	}
+
+	text := `# version: 0 (DO NOT MODIFY THIS LINE)
+a:
+  # I will be gone.
+  many:
+    val: 5
+`
+
+	doc := NewYamlDocument()
+	cfg, err := Open(doc.Decoder(strings.NewReader(text)), defaults, StrictnessPanic)
+	require.Nil(t, err)
+	require.Nil(t, cfg.Reset("a.many"))
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, cfg.Save(doc.Encoder(buf)))
+	require.NotContains(t, buf.String(), "many")
+}
+
+func TestToYamlFileKeepsComments(t *testing.T) {
+	fd, err := ioutil.TempFile("", "config-test-")
+	require.Nil(t, err)
+
+	path := fd.Name()
+	defer os.Remove(path)
+
+	_, err = fd.WriteString("# version: 0\ndaemon:\n  # my port!\n  port: 1234\n")
+	require.Nil(t, err)
+	require.Nil(t, fd.Close())
+
+	cfg, err := FromYamlFile(path, TestDefaults, StrictnessPanic)
+	require.Nil(t, err)
+	require.Nil(t, cfg.SetInt("daemon.port", 4321))
+	require.Nil(t, ToYamlFile(path, cfg))
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	require.Contains(t, string(data), "  # my port!\n  port: 4321\n")
+}
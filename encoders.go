@@ -1,12 +1,18 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sort"
 	"strconv"
+	"strings"
 
+	"github.com/BurntSushi/toml"
 	yaml "gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 // Encoder defines how the config can be serialized to a byte stream
@@ -23,6 +29,36 @@ type Decoder interface {
 	Decode() (Version, map[interface{}]interface{}, error)
 }
 
+// PositionDecoder is a Decoder that remembers where each key was found.
+// If a decoder implements it, validation errors will carry the position of
+// the invalid key.
+type PositionDecoder interface {
+	Decoder
+
+	// Positions maps every full key to its position.
+	// It's only valid after Decode() was called.
+	Positions() map[string]Position
+}
+
+// decoderPositions returns the positions of `dec`, if it knows them.
+func decoderPositions(dec Decoder) map[string]Position {
+	if pd, ok := dec.(PositionDecoder); ok {
+		return pd.Positions()
+	}
+
+	return nil
+}
+
+// DefaultKeysEncoder is an Encoder that treats keys differently that were not
+// set explicitly. If an encoder implements it, Save() passes it the full keys
+// that still have their default value before calling Encode().
+type DefaultKeysEncoder interface {
+	Encoder
+
+	// SetDefaultKeys remembers the keys that have their default value.
+	SetDefaultKeys(keys map[string]struct{})
+}
+
 ////////////
 
 type yamlEncoder struct {
@@ -55,16 +91,227 @@ func (ye *yamlEncoder) Encode(version Version, memory map[interface{}]interface{
 
 ////////////
 
+type documentedYamlEncoder struct {
+	w        io.Writer
+	defaults DefaultMapping
+}
+
+// NewDocumentedYamlEncoder works like NewYamlEncoder, but writes the
+// documentation of each key in `defaults` as comment above it.  Keys that
+// need a restart are marked as such and if a value differs from its
+// default, the default is noted down too. This is useful to generate a
+// config file that documents itself.
+func NewDocumentedYamlEncoder(w io.Writer, defaults DefaultMapping) Encoder {
+	return &documentedYamlEncoder{w: w, defaults: defaults}
+}
+
+// formatDefault renders `val` as short, single line YAML.
+func formatDefault(val interface{}) (string, error) {
+	node, err := newYamlValue(val)
+	if err != nil {
+		return "", err
+	}
+
+	if node.Kind == yamlv3.SequenceNode {
+		node.Style = yamlv3.FlowStyle
+	}
+
+	data, err := yamlv3.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// docComment builds the comment that is shown above a key.
+func docComment(entry *DefaultEntry, val interface{}) (string, error) {
+	lines := []string{}
+	if entry.Docs != "" {
+		lines = append(lines, strings.Split(strings.TrimSpace(entry.Docs), "\n")...)
+	}
+
+	if entry.NeedsRestart {
+		lines = append(lines, "(requires restart)")
+	}
+
+	// Use the YAML comparison to ignore differences like int vs. int64:
+	defNode, err := newYamlValue(entry.Default)
+	if err != nil {
+		return "", err
+	}
+
+	if !yamlNodeEquals(defNode, val) {
+		def, err := formatDefault(entry.Default)
+		if err != nil {
+			return "", err
+		}
+
+		lines = append(lines, fmt.Sprintf("(default: %s)", def))
+	}
+
+	for idx, line := range lines {
+		lines[idx] = strings.TrimRight("# "+line, " ")
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func (de *documentedYamlEncoder) buildMapping(section map[interface{}]interface{}, prefix string) (*yamlv3.Node, error) {
+	sectionKeys := []string{}
+	for keyVal := range section {
+		key, ok := keyVal.(string)
+		if !ok {
+			return nil, fmt.Errorf("config contains non string keys: %v", keyVal)
+		}
+
+		sectionKeys = append(sectionKeys, key)
+	}
+
+	sort.Strings(sectionKeys)
+
+	mapping := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+	for _, key := range sectionKeys {
+		fullKey := prefixKey(prefix, key)
+		keyNode := newYamlKey(key)
+
+		var valNode *yamlv3.Node
+		var err error
+
+		switch child := section[key].(type) {
+		case map[interface{}]interface{}:
+			valNode, err = de.buildMapping(child, fullKey)
+		default:
+			valNode, err = newYamlValue(child)
+			if err != nil {
+				return nil, err
+			}
+
+			entry := getDefaultByKey(fullKey, de.defaults, StrictnessIgnore)
+			if entry != nil {
+				keyNode.HeadComment, err = docComment(entry, child)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		mapping.Content = append(mapping.Content, keyNode, valNode)
+	}
+
+	return mapping, nil
+}
+
+func (de *documentedYamlEncoder) Encode(version Version, memory map[interface{}]interface{}) error {
+	mapping, err := de.buildMapping(memory, "")
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	enc := yamlv3.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(mapping); err != nil {
+		return err
+	}
+
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	_, err = de.w.Write(replaceVersionHeader(buf.Bytes(), version))
+	return err
+}
+
+////////////
+
 type yamlDecoder struct {
-	r io.Reader
+	r         io.Reader
+	positions map[string]Position
 }
 
 // NewYamlDecoder creates a new Decoder that parses the data in `r`.
 // It will look at the first line of the input to get the version.
+// The decoder implements PositionDecoder. If `r` has a Name() method
+// (like *os.File), the name is used as file name in the positions.
 func NewYamlDecoder(r io.Reader) Decoder {
 	return &yamlDecoder{r: r}
 }
 
+func (yd *yamlDecoder) Positions() map[string]Position {
+	return yd.positions
+}
+
+// yamlPositions records the position of every key below `node`.
+func yamlPositions(node *yamlv3.Node, file string, prefix string, positions map[string]Position) {
+	node = resolveAlias(node)
+	if node == nil {
+		return
+	}
+
+	if node.Kind == yamlv3.DocumentNode {
+		for _, child := range node.Content {
+			yamlPositions(child, file, prefix, positions)
+		}
+
+		return
+	}
+
+	if node.Kind != yamlv3.MappingNode {
+		return
+	}
+
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		keyNode, valNode := node.Content[idx], node.Content[idx+1]
+		if keyNode.Tag == "!!merge" {
+			// Keys taken over via "<<" are reported at the place
+			// where they were defined originally.
+			valNode = resolveAlias(valNode)
+			if valNode != nil && valNode.Kind == yamlv3.SequenceNode {
+				for _, merged := range valNode.Content {
+					yamlPositions(merged, file, prefix, positions)
+				}
+			} else {
+				yamlPositions(valNode, file, prefix, positions)
+			}
+
+			continue
+		}
+
+		key := prefixKey(prefix, keyNode.Value)
+		positions[key] = Position{
+			File:   file,
+			Line:   keyNode.Line,
+			Column: keyNode.Column,
+		}
+
+		yamlPositions(valNode, file, key, positions)
+	}
+}
+
+// readerName returns the name of `r`, if it has one (like *os.File).
+func readerName(r io.Reader) string {
+	if named, ok := r.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+
+	return ""
+}
+
+// decodeYamlPositions returns the positions of all keys in `data`.
+// Broken data yields no positions; the error is reported elsewhere.
+func decodeYamlPositions(data []byte, file string) map[string]Position {
+	root := &yamlv3.Node{}
+	if err := yamlv3.Unmarshal(data, root); err != nil {
+		return nil
+	}
+
+	positions := make(map[string]Position)
+	yamlPositions(root, file, "", positions)
+	return positions
+}
+
 func readVersionFromData(data []byte) (Version, error) {
 	match := versionTag.FindSubmatch(data)
 	if match == nil {
@@ -99,5 +346,188 @@ func (yd *yamlDecoder) Decode() (Version, map[interface{}]interface{}, error) {
 		return Version(-1), nil, err
 	}
 
+	yd.positions = decodeYamlPositions(data, readerName(yd.r))
 	return version, memory, nil
 }
+
+////////////
+
+// jsonVersionKey is the reserved top-level key that holds the version.
+// JSON has no comments, so it can't be stored as header like in YAML.
+const jsonVersionKey = "__version__"
+
+type jsonEncoder struct {
+	w io.Writer
+}
+
+// NewJsonEncoder creates a new Encoder that writes a JSON object with the
+// config data. The version is stored in the reserved top-level key
+// "__version__", so pay attention to not remove it by accident.
+func NewJsonEncoder(w io.Writer) Encoder {
+	return &jsonEncoder{w: w}
+}
+
+// stringifyKeys converts the nested config representation to something
+// that encoding/json is able to marshal.
+func stringifyKeys(memory map[interface{}]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(memory))
+	for keyVal, child := range memory {
+		key, ok := keyVal.(string)
+		if !ok {
+			return nil, fmt.Errorf("config contains non string keys: %v", keyVal)
+		}
+
+		if section, ok := child.(map[interface{}]interface{}); ok {
+			converted, err := stringifyKeys(section)
+			if err != nil {
+				return nil, err
+			}
+
+			result[key] = converted
+			continue
+		}
+
+		result[key] = child
+	}
+
+	return result, nil
+}
+
+func (je *jsonEncoder) Encode(version Version, memory map[interface{}]interface{}) error {
+	root, err := stringifyKeys(memory)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := root[jsonVersionKey]; ok {
+		return fmt.Errorf("config may not contain the reserved key `%s`", jsonVersionKey)
+	}
+
+	root[jsonVersionKey] = version
+
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = je.w.Write(append(data, '\n'))
+	return err
+}
+
+////////////
+
+type jsonDecoder struct {
+	r io.Reader
+}
+
+// NewJsonDecoder creates a new Decoder that parses the JSON object in `r`.
+// It will look at the reserved "__version__" key to get the version.
+// Numbers are passed on as json.Number and converted once the type of
+// the respective key is known.
+func NewJsonDecoder(r io.Reader) Decoder {
+	return &jsonDecoder{r: r}
+}
+
+// interfaceKeys is the opposite of stringifyKeys.
+func interfaceKeys(root map[string]interface{}) map[interface{}]interface{} {
+	result := make(map[interface{}]interface{}, len(root))
+	for key, child := range root {
+		if section, ok := child.(map[string]interface{}); ok {
+			result[key] = interfaceKeys(section)
+			continue
+		}
+
+		result[key] = child
+	}
+
+	return result
+}
+
+func (jd *jsonDecoder) Decode() (Version, map[interface{}]interface{}, error) {
+	dec := json.NewDecoder(jd.r)
+	dec.UseNumber()
+
+	root := make(map[string]interface{})
+	if err := dec.Decode(&root); err != nil {
+		return Version(-1), nil, err
+	}
+
+	version := Version(0)
+	if versionVal, ok := root[jsonVersionKey]; ok {
+		num, ok := versionVal.(json.Number)
+		if !ok {
+			return Version(-1), nil, fmt.Errorf("version is not a number: %v", versionVal)
+		}
+
+		parsed, err := num.Int64()
+		if err != nil {
+			return Version(-1), nil, err
+		}
+
+		version = Version(parsed)
+		delete(root, jsonVersionKey)
+	}
+
+	return version, interfaceKeys(root), nil
+}
+
+////////////
+
+type tomlEncoder struct {
+	w io.Writer
+}
+
+// NewTomlEncoder creates a new Encoder that writes a TOML file with the
+// config data. Sections (including the ones below __many__) are written
+// as tables. Like the YAML output, the file will start with a comment
+// indicating the version, so pay attention to not remove it by accident.
+func NewTomlEncoder(w io.Writer) Encoder {
+	return &tomlEncoder{w: w}
+}
+
+func (te *tomlEncoder) Encode(version Version, memory map[interface{}]interface{}) error {
+	root, err := stringifyKeys(memory)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# version: %d (DO NOT MODIFY THIS LINE)\n", version)
+	if err := toml.NewEncoder(buf).Encode(root); err != nil {
+		return err
+	}
+
+	_, err = te.w.Write(buf.Bytes())
+	return err
+}
+
+////////////
+
+type tomlDecoder struct {
+	r io.Reader
+}
+
+// NewTomlDecoder creates a new Decoder that parses the TOML data in `r`.
+// It will look at the first line of the input to get the version.
+func NewTomlDecoder(r io.Reader) Decoder {
+	return &tomlDecoder{r: r}
+}
+
+func (td *tomlDecoder) Decode() (Version, map[interface{}]interface{}, error) {
+	data, err := ioutil.ReadAll(td.r)
+	if err != nil {
+		return Version(-1), nil, err
+	}
+
+	version, err := readVersionFromData(data)
+	if err != nil && err != ErrNotVersioned {
+		return Version(-1), nil, err
+	}
+
+	root := make(map[string]interface{})
+	if err := toml.Unmarshal(data, &root); err != nil {
+		return Version(-1), nil, err
+	}
+
+	return version, interfaceKeys(root), nil
+}
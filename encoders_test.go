@@ -0,0 +1,207 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJsonOpenSave(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	cfg.version = Version(3)
+	require.Nil(t, cfg.SetInt("daemon.port", 6666))
+	require.Nil(t, cfg.SetString("data.ipfs.path", "y"))
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, cfg.Save(NewJsonEncoder(buf)))
+	require.Contains(t, buf.String(), `"__version__": 3`)
+
+	newCfg, err := Open(NewJsonDecoder(buf), TestDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	require.Equal(t, Version(3), newCfg.Version())
+	configMustEquals(t, cfg, newCfg)
+}
+
+func TestJsonNumbers(t *testing.T) {
+	defaults := DefaultMapping{
+		"int": DefaultEntry{
+			Default: 2,
+		},
+		"float": DefaultEntry{
+			Default: 3.0,
+		},
+		"section": DefaultMapping{
+			"ints": DefaultEntry{
+				Default: []int{1, 2, 3},
+			},
+			"floats": DefaultEntry{
+				Default: []float64{1.5},
+			},
+		},
+	}
+
+	data := `{
+	"__version__": 1,
+	"int": 42,
+	"float": 5,
+	"section": {
+		"ints": [4, 5],
+		"floats": [1, 2.5]
+	}
+}`
+
+	cfg, err := Open(NewJsonDecoder(strings.NewReader(data)), defaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	require.Equal(t, Version(1), cfg.Version())
+	require.Equal(t, int64(42), cfg.Get("int"))
+	require.Equal(t, float64(5), cfg.Get("float"))
+	require.Equal(t, []int64{4, 5}, cfg.Get("section.ints"))
+	require.Equal(t, []float64{1, 2.5}, cfg.Get("section.floats"))
+}
+
+func TestJsonBadInput(t *testing.T) {
+	tcs := []string{
+		`{"daemon": {"port": "xxx"}}`,
+		`{"daemon": {"port": 1.5e100}}`,
+		`{"not": {"existing": 1}}`,
+		`{"__version__": "1"}`,
+		`["daemon"]`,
+		`{`,
+	}
+
+	for _, tc := range tcs {
+		_, err := Open(NewJsonDecoder(strings.NewReader(tc)), TestDefaults, StrictnessPanic)
+		require.NotNil(t, err, tc)
+	}
+}
+
+func TestJsonMigrate(t *testing.T) {
+	mgr := NewMigrater(1, StrictnessPanic)
+	mgr.Add(0, nil, TestDefaultsV0)
+	mgr.Add(1, migrateToV1, TestDefaultsV1)
+
+	cfg, err := mgr.Migrate(NewJsonDecoder(strings.NewReader(`{"a": {"b": 20}}`)))
+	require.Nil(t, err)
+
+	require.Equal(t, Version(1), cfg.Version())
+	require.Equal(t, int64(20), cfg.Int("a.b"))
+	require.Equal(t, 60.0, cfg.Float("a.new_key"))
+}
+
+func TestTomlOpenSave(t *testing.T) {
+	defaults := DefaultMapping{
+		"string": DefaultEntry{
+			Default: "a",
+		},
+		"int": DefaultEntry{
+			Default: 2,
+		},
+		"float": DefaultEntry{
+			Default: 3.0,
+		},
+		"bool": DefaultEntry{
+			Default: false,
+		},
+		"lists": DefaultMapping{
+			"strings": DefaultEntry{
+				Default: []string{"a", "b", "c"},
+			},
+			"ints": DefaultEntry{
+				Default: []int64{1, 2, 3},
+			},
+			"floats": DefaultEntry{
+				Default: []float64{1.0, 2.5},
+			},
+			"bools": DefaultEntry{
+				Default: []bool{true, false},
+			},
+		},
+		"mounts": DefaultMapping{
+			"__many__": DefaultMapping{
+				"path": DefaultEntry{
+					Default: "",
+				},
+				"read_only": DefaultEntry{
+					Default: false,
+				},
+			},
+		},
+	}
+
+	cfg, err := Open(nil, defaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	cfg.version = Version(2)
+	require.Nil(t, cfg.SetString("string", "b"))
+	require.Nil(t, cfg.SetInt("int", 3))
+	require.Nil(t, cfg.SetFloat("float", 4.5))
+	require.Nil(t, cfg.SetBool("bool", true))
+	require.Nil(t, cfg.SetStrings("lists.strings", []string{"x"}))
+	require.Nil(t, cfg.SetInts("lists.ints", []int64{}))
+	require.Nil(t, cfg.SetString("mounts.music.path", "/music"))
+	require.Nil(t, cfg.SetBool("mounts.music.read_only", true))
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, cfg.Save(NewTomlEncoder(buf)))
+	require.True(t, strings.HasPrefix(buf.String(), "# version: 2"))
+	require.Contains(t, buf.String(), "[mounts.music]")
+
+	newCfg, err := Open(NewTomlDecoder(buf), defaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	require.Equal(t, Version(2), newCfg.Version())
+	configMustEquals(t, cfg, newCfg)
+}
+
+func TestTomlBadInput(t *testing.T) {
+	tcs := []string{
+		"[daemon]\nport = \"xxx\"",
+		"[not]\nexisting = 1",
+		"[daemon",
+	}
+
+	for _, tc := range tcs {
+		_, err := Open(NewTomlDecoder(strings.NewReader(tc)), TestDefaults, StrictnessPanic)
+		require.NotNil(t, err, tc)
+	}
+}
+
+func TestDocumentedYamlEncoder(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, cfg.Save(NewDocumentedYamlEncoder(buf, TestDefaults)))
+
+	out := buf.String()
+	require.True(t, strings.HasPrefix(out, "# version: 0 (DO NOT MODIFY THIS LINE)\n"))
+	require.Contains(t, out, `daemon:
+  # Port of the daemon process
+  # (requires restart)
+  # (default: 6666)
+  port: 6667
+`)
+
+	// Same as default, no need to show it:
+	require.Contains(t, out, `    # What compression algorithm to use by default
+    default_algo: snappy
+`)
+
+	// No docs, but a restart marker:
+	require.Contains(t, out, `    # Root directory of the ipfs repository
+    # (requires restart)
+    # (default: "")
+    path: x
+`)
+
+	// Docs should not disturb reading the config again:
+	newCfg, err := Open(NewYamlDecoder(buf), TestDefaults, StrictnessPanic)
+	require.Nil(t, err)
+	configMustEquals(t, cfg, newCfg)
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	e "github.com/pkg/errors"
+)
+
+// EnvName returns the name of the environment variable that is used by
+// ApplyEnv() for `key`. The key is upper-cased, its dots are replaced by
+// `separator` and `prefix` is put in front of it.
+// Example: EnvName("APP", "_", "daemon.port") -> "APP_DAEMON_PORT"
+func EnvName(prefix, separator, key string) string {
+	name := strings.ToUpper(strings.Replace(key, ".", separator, -1))
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + separator + name
+}
+
+// ApplyEnv overlays the config with values from environment variables.
+// The name of the variable for each key is built by EnvName().
+// The values are converted like in Cast(), i.e. lists are separated by " ;; ".
+// Every value has to pass the validator of its key, otherwise an error is
+// returned. Keys that were applied up to this point stay applied.
+//
+// Overridden keys are not saved by Save(); the value they had before is
+// written instead. Otherwise they count as explicitly set keys, i.e.
+// IsDefault() returns false for them and Merge() takes them over.
+// Reload() keeps the overrides and applies them on top of the new values.
+// Setting an overridden key explicitly makes it a normal key again.
+//
+// Only keys that are present in the config are considered. This means that
+// sections below __many__ can only be overridden if they exist already.
+// The keys that were overridden are returned.
+func (cfg *Config) ApplyEnv(prefix, separator string) ([]string, error) {
+	return cfg.applyEnv(os.Environ(), prefix, separator)
+}
+
+func (cfg *Config) applyEnv(environ []string, prefix, separator string) ([]string, error) {
+	env := make(map[string]string)
+	for _, entry := range environ {
+		split := strings.SplitN(entry, "=", 2)
+		if len(split) < 2 {
+			continue
+		}
+
+		env[split[0]] = split[1]
+	}
+
+	applied := []string{}
+	for _, key := range cfg.Keys() {
+		val, ok := env[EnvName(prefix, separator, key)]
+		if !ok {
+			continue
+		}
+
+		castVal, err := cfg.Cast(key, val)
+		if err != nil {
+			return applied, e.Wrapf(err, "cast %s", key)
+		}
+
+		if err := cfg.override(key, castVal); err != nil {
+			return applied, err
+		}
+
+		applied = append(applied, key)
+	}
+
+	return applied, nil
+}
+
+// override sets `key` to `val` and remembers
+// that the old value should be saved instead.
+func (cfg *Config) override(key string, val interface{}) error {
+	cfg.mu.Lock()
+
+	fullKey := prefixKey(cfg.section, key)
+	events := []pendingEvent{}
+	defer func() {
+		// Call the callbacks without the lock:
+		fireEvents(events)
+	}()
+
+	// NOTE: the unlock is called before the other defer!
+	defer cfg.mu.Unlock()
+
+	entry, isOverridden := cfg.overrides[fullKey]
+	if !isOverridden {
+		saved, err := cfg.currentValue(fullKey)
+		if err != nil {
+			return err
+		}
+
+		_, wasDefault := cfg.defaultKeys[fullKey]
+		entry = overrideEntry{saved: saved, wasDefault: wasDefault}
+	}
+
+	if err := cfg.checkSet(fullKey, val); err != nil {
+		return err
+	}
+
+	if err := cfg.checkConfigValidators(map[string]interface{}{fullKey: val}); err != nil {
+		return err
+	}
+
+	var err error
+	events, err = cfg.applySet(fullKey, val, OriginSet)
+	if err != nil {
+		return err
+	}
+
+	entry.val = val
+	cfg.overrides[fullKey] = entry
+	return nil
+}
+
+// reapplyOverrides sets the overridden keys in the freshly decoded `memory`
+// again, which has the defaults merged into it already. The values found in
+// `memory` are what Save() writes from now on. It returns the new overrides
+// instead of modifying cfg.overrides, since the memory still needs to be
+// validated. Keys that do not exist in `memory` anymore (like sections below
+// __many__ that were removed) lose their override.
+// Call with cfg.mu locked.
+func (cfg *Config) reapplyOverrides(memory map[interface{}]interface{}, defaultKeys map[string]struct{}) map[string]overrideEntry {
+	overrides := make(map[string]overrideEntry, len(cfg.overrides))
+	for key, entry := range cfg.overrides {
+		parent, base := splitKeyRecursive(strings.Split(key, "."), memory, false)
+		if parent == nil {
+			continue
+		}
+
+		saved, ok := parent[base]
+		if !ok {
+			continue
+		}
+
+		_, wasDefault := defaultKeys[key]
+		delete(defaultKeys, key)
+
+		parent[base] = entry.val
+		overrides[key] = overrideEntry{
+			val:        entry.val,
+			saved:      saved,
+			wasDefault: wasDefault,
+		}
+	}
+
+	return overrides
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvName(t *testing.T) {
+	require.Equal(t, "APP_DAEMON_PORT", EnvName("APP", "_", "daemon.port"))
+	require.Equal(t, "APP__FS__SYNC__IGNORE_MOVED", EnvName("APP", "__", "fs.sync.ignore_moved"))
+	require.Equal(t, "DAEMON_PORT", EnvName("", "_", "daemon.port"))
+}
+
+func TestApplyEnv(t *testing.T) {
+	defaults := DefaultMapping{
+		"daemon": DefaultMapping{
+			"port": DefaultEntry{
+				Default:   6666,
+				Validator: IntRangeValidator(1, 65536),
+			},
+			"hosts": DefaultEntry{
+				Default: []string{"localhost"},
+			},
+		},
+		"fs": DefaultMapping{
+			"ignore_moved": DefaultEntry{
+				Default: false,
+			},
+		},
+	}
+
+	cfg, err := openFromString("daemon:\n  port: 7777\n", defaults)
+	require.Nil(t, err)
+
+	applied, err := cfg.applyEnv([]string{
+		"APP_DAEMON_PORT=8888",
+		"APP_DAEMON_HOSTS=a ;; b",
+		"APP_FS_IGNORE_MOVED=true",
+		"APP_UNKNOWN=1",
+		"HOME=/root",
+	}, "APP", "_")
+	require.Nil(t, err)
+	require.Equal(t, []string{"daemon.hosts", "daemon.port", "fs.ignore_moved"}, applied)
+
+	require.Equal(t, int64(8888), cfg.Int("daemon.port"))
+	require.Equal(t, []string{"a", "b"}, cfg.Strings("daemon.hosts"))
+	require.Equal(t, true, cfg.Bool("fs.ignore_moved"))
+
+	// Applying it twice should still remember the original values:
+	_, err = cfg.applyEnv([]string{"APP_DAEMON_PORT=9999"}, "APP", "_")
+	require.Nil(t, err)
+	require.Equal(t, int64(9999), cfg.Int("daemon.port"))
+
+	// Overrides should not be saved:
+	buf := &bytes.Buffer{}
+	require.Nil(t, cfg.Save(NewYamlEncoder(buf)))
+
+	savedCfg, err := Open(NewYamlDecoder(bytes.NewReader(buf.Bytes())), defaults, StrictnessPanic)
+	require.Nil(t, err)
+	require.Equal(t, int64(7777), savedCfg.Int("daemon.port"))
+	require.Equal(t, []string{"localhost"}, savedCfg.Strings("daemon.hosts"))
+	require.Equal(t, false, savedCfg.Bool("fs.ignore_moved"))
+
+	// Explicitly set keys should be saved again:
+	require.Nil(t, cfg.SetInt("daemon.port", 1234))
+	buf.Reset()
+	require.Nil(t, cfg.Save(NewYamlEncoder(buf)))
+
+	savedCfg, err = Open(NewYamlDecoder(buf), defaults, StrictnessPanic)
+	require.Nil(t, err)
+	require.Equal(t, int64(1234), savedCfg.Int("daemon.port"))
+}
+
+func TestApplyEnvInvalid(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	// Not an int:
+	_, err = cfg.applyEnv([]string{"APP_DAEMON_PORT=xxx"}, "APP", "_")
+	require.NotNil(t, err)
+
+	// Does not pass the validator:
+	_, err = cfg.applyEnv([]string{"APP_DAEMON_PORT=0"}, "APP", "_")
+	require.NotNil(t, err)
+
+	_, err = cfg.applyEnv([]string{"APP_FS_COMPRESS_DEFAULT_ALGO=zip"}, "APP", "_")
+	require.NotNil(t, err)
+
+	require.Equal(t, int64(6667), cfg.Int("daemon.port"))
+	require.Equal(t, "snappy", cfg.String("fs.compress.default_algo"))
+}
+
+func TestApplyEnvSection(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	fsSec := cfg.Section("fs")
+	applied, err := fsSec.applyEnv([]string{"FS_COMPRESS_DEFAULT_ALGO=lz4"}, "FS", "_")
+	require.Nil(t, err)
+	require.Equal(t, []string{"compress.default_algo"}, applied)
+	require.Equal(t, "lz4", cfg.String("fs.compress.default_algo"))
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, cfg.Save(NewYamlEncoder(buf)))
+	require.NotContains(t, buf.String(), "lz4")
+}
+
+func TestApplyEnvIsNotDefault(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	require.True(t, cfg.IsDefault("fs.compress.default_algo"))
+	_, err = cfg.applyEnv([]string{
+		"APP_FS_COMPRESS_DEFAULT_ALGO=lz4",
+		"APP_DAEMON_PORT=7777",
+	}, "APP", "_")
+	require.Nil(t, err)
+
+	require.Equal(t, "lz4", cfg.String("fs.compress.default_algo"))
+	require.False(t, cfg.IsDefault("fs.compress.default_algo"))
+	require.False(t, cfg.IsDefault("daemon.port"))
+
+	// Overridden keys are merged like explicitly set ones:
+	other, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+	require.Nil(t, other.Merge(cfg))
+	require.Equal(t, "lz4", other.String("fs.compress.default_algo"))
+	require.Equal(t, int64(7777), other.Int("daemon.port"))
+
+	// ...and win in a layered config:
+	low, err := openFromString("daemon:\n  port: 7000\n", TestDefaults)
+	require.Nil(t, err)
+
+	high, err := openFromString("", TestDefaults)
+	require.Nil(t, err)
+	_, err = high.applyEnv([]string{"APP_DAEMON_PORT=9000"}, "APP", "_")
+	require.Nil(t, err)
+
+	lc, err := NewLayered(low, high)
+	require.Nil(t, err)
+	require.Equal(t, int64(9000), lc.Int("daemon.port"))
+	require.Equal(t, 1, lc.Source("daemon.port"))
+}
+
+func TestApplyEnvSurvivesReload(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	_, err = cfg.applyEnv([]string{
+		"APP_FS_COMPRESS_DEFAULT_ALGO=lz4",
+		"APP_DAEMON_PORT=9000",
+	}, "APP", "_")
+	require.Nil(t, err)
+
+	newConfig := strings.Replace(testConfig, "port: 6667", "port: 7777", 1)
+	newConfig = strings.Replace(newConfig, "path: x", "path: /ipfs", 1)
+
+	report, err := cfg.ReloadWithReport(NewYamlDecoder(strings.NewReader(newConfig)))
+	require.Nil(t, err)
+	require.Equal(t, []string{"data.ipfs.path"}, report.RestartKeys())
+	require.Empty(t, report.LiveKeys())
+
+	require.Equal(t, int64(9000), cfg.Int("daemon.port"))
+	require.Equal(t, "lz4", cfg.String("fs.compress.default_algo"))
+	require.Equal(t, "/ipfs", cfg.String("data.ipfs.path"))
+
+	// The reloaded values are saved instead of the overrides:
+	buf := &bytes.Buffer{}
+	require.Nil(t, cfg.Save(NewYamlEncoder(buf)))
+
+	savedCfg, err := Open(NewYamlDecoder(buf), TestDefaults, StrictnessPanic)
+	require.Nil(t, err)
+	require.Equal(t, int64(7777), savedCfg.Int("daemon.port"))
+	require.Equal(t, "snappy", savedCfg.String("fs.compress.default_algo"))
+
+	// Reset() drops them:
+	require.Nil(t, cfg.Reset(""))
+	require.Equal(t, int64(6666), cfg.Int("daemon.port"))
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// InvalidKeyError is returned when a key (or section) is used that is not
+// part of the defaults. Unless StrictnessIgnore is used, this is a bug and
+// also causes a complaint.
+type InvalidKeyError struct {
+	Key string
+}
+
+func (ike *InvalidKeyError) Error() string {
+	return fmt.Sprintf("invalid config key: %s", ike.Key)
+}
+
+// TypeMismatchError is returned when a value does not have the type
+// the defaults expect for a key.
+type TypeMismatchError struct {
+	Key  string
+	Want string
+	Got  string
+}
+
+func (tme *TypeMismatchError) Error() string {
+	return fmt.Sprintf("wrong type for key `%s`: want `%s` but got `%s`", tme.Key, tme.Want, tme.Got)
+}
+
+// ValidationError describes a single key that did not pass validation.
+// Err is either an *InvalidKeyError, a *TypeMismatchError or the error
+// returned by the validator of the key.
+type ValidationError struct {
+	// Key is the full key of the invalid value.
+	Key string
+
+	// Value is the value that was rejected.
+	Value interface{}
+
+	// Want is the type the defaults expect.
+	// It is empty if the key is not known at all.
+	Want string
+
+	// Got is the type of the value that was found.
+	Got string
+
+	// Pos is the place in the source where the key was found.
+	// It's only valid if the decoder implements PositionDecoder.
+	Pos Position
+
+	// Err is the reason why the value is invalid.
+	// For validator failures, it's the error returned by the validator.
+	Err error
+}
+
+func (ve *ValidationError) Error() string {
+	msg := fmt.Sprintf("%s: %v", ve.Key, ve.Err)
+	switch ve.Err.(type) {
+	case *InvalidKeyError, *TypeMismatchError:
+		// Those already mention the key.
+		msg = ve.Err.Error()
+	}
+
+	if ve.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", ve.Pos, msg)
+	}
+
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (ve *ValidationError) Unwrap() error {
+	return ve.Err
+}
+
+// Position describes a place in a config file.
+type Position struct {
+	// File is the name of the file, if known.
+	File string
+
+	// Line and Column start at 1.
+	Line   int
+	Column int
+}
+
+// IsValid returns true if the position is known.
+func (pos Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+func (pos Position) String() string {
+	if pos.File == "" {
+		return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+
+	return fmt.Sprintf("%s:%d:%d", pos.File, pos.Line, pos.Column)
+}
+
+// ValidationErrors holds all errors that were found while validating a
+// config. It's returned by Open() and Reload(), possibly wrapped, and can be
+// retrieved via errors.As(). Iterate over it to get the single errors.
+type ValidationErrors []*ValidationError
+
+func (ves ValidationErrors) Error() string {
+	if len(ves) == 1 {
+		return ves[0].Error()
+	}
+
+	msgs := []string{}
+	for _, ve := range ves {
+		msgs = append(msgs, "\t"+ve.Error())
+	}
+
+	return fmt.Sprintf("%d invalid keys:\n%s", len(ves), strings.Join(msgs, "\n"))
+}
+
+// Unwrap returns all single errors, so errors.Is() and errors.As()
+// can be used to look for a specific one.
+func (ves ValidationErrors) Unwrap() []error {
+	errs := make([]error, 0, len(ves))
+	for _, ve := range ves {
+		errs = append(errs, ve)
+	}
+
+	return errs
+}
+
+// sort sorts the errors by key, so they are reported in a stable order.
+func (ves ValidationErrors) sort() {
+	sort.SliceStable(ves, func(i, j int) bool {
+		return ves[i].Key < ves[j].Key
+	})
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidationErrorsAggregated(t *testing.T) {
+	data := `daemon:
+  port: "xxx"
+fs:
+  compress:
+    default_algo: gzip
+not:
+  existing: 1
+`
+
+	_, err := openFromString(data, TestDefaults)
+	require.NotNil(t, err)
+
+	var validationErrs ValidationErrors
+	require.True(t, errors.As(err, &validationErrs))
+	require.Len(t, validationErrs, 3)
+
+	require.Equal(t, "daemon.port", validationErrs[0].Key)
+	require.Equal(t, "int", validationErrs[0].Want)
+	require.Equal(t, "string", validationErrs[0].Got)
+
+	require.Equal(t, "fs.compress.default_algo", validationErrs[1].Key)
+	require.Equal(t, "string", validationErrs[1].Want)
+	require.Contains(t, validationErrs[1].Err.Error(), "not a valid enum value")
+
+	require.Equal(t, "not.existing", validationErrs[2].Key)
+	require.Equal(t, "", validationErrs[2].Want)
+
+	// All of them should be printed:
+	msg := err.Error()
+	require.Contains(t, msg, "3 invalid keys")
+	for _, ve := range validationErrs {
+		require.Contains(t, msg, ve.Error())
+	}
+}
+
+func TestValidationErrorsReload(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	err = cfg.Reload(NewYamlDecoder(strings.NewReader("daemon:\n  port: 0\n")))
+	require.NotNil(t, err)
+
+	var ve *ValidationError
+	require.True(t, errors.As(err, &ve))
+	require.Equal(t, "daemon.port", ve.Key)
+	require.Equal(t, int64(6667), cfg.Int("daemon.port"))
+}
+
+func TestValidationErrorPositions(t *testing.T) {
+	data := `daemon:
+  port: "xxx"
+base: &base
+  existing: 1
+not:
+  <<: *base
+`
+
+	_, err := openFromString(data, TestDefaults)
+	require.NotNil(t, err)
+
+	var validationErrs ValidationErrors
+	require.True(t, errors.As(err, &validationErrs))
+	require.Len(t, validationErrs, 3)
+
+	require.Equal(t, "base.existing", validationErrs[0].Key)
+	require.Equal(t, Position{Line: 4, Column: 3}, validationErrs[0].Pos)
+	require.Equal(t, "daemon.port", validationErrs[1].Key)
+	require.Equal(t, Position{Line: 2, Column: 3}, validationErrs[1].Pos)
+
+	// Merged keys are reported where they were defined:
+	require.Equal(t, "not.existing", validationErrs[2].Key)
+	require.Equal(t, Position{Line: 4, Column: 3}, validationErrs[2].Pos)
+
+	require.Contains(t, err.Error(), "2:3: wrong type for key `daemon.port`")
+}
+
+func TestValidationErrorFilePosition(t *testing.T) {
+	fd, err := ioutil.TempFile("", "config-test-")
+	require.Nil(t, err)
+
+	path := fd.Name()
+	defer os.Remove(path)
+
+	_, err = fd.WriteString("# version: 0\nfs:\n  compress:\n    default_algo: gzip\n")
+	require.Nil(t, err)
+	require.Nil(t, fd.Close())
+
+	_, err = FromYamlFile(path, TestDefaults, StrictnessPanic)
+	require.NotNil(t, err)
+
+	var ve *ValidationError
+	require.True(t, errors.As(err, &ve))
+	require.Equal(t, Position{File: path, Line: 4, Column: 5}, ve.Pos)
+	require.Contains(t, err.Error(), path+":4:5: fs.compress.default_algo: not a valid enum value")
+}
+
+func TestTypedErrors(t *testing.T) {
+	cfg, err := Open(nil, TestDefaults, StrictnessIgnore)
+	require.Nil(t, err)
+
+	var ike *InvalidKeyError
+	require.True(t, errors.As(cfg.SetInt("not.existing", 1), &ike))
+	require.Equal(t, "not.existing", ike.Key)
+
+	_, err = cfg.Cast("not.existing", "1")
+	require.True(t, errors.As(err, &ike))
+	require.True(t, errors.As(cfg.Reset("not.existing"), &ike))
+
+	var tme *TypeMismatchError
+	require.True(t, errors.As(cfg.SetString("daemon.port", "x"), &tme))
+	require.Equal(t, &TypeMismatchError{Key: "daemon.port", Want: "int", Got: "string"}, tme)
+
+	var ve *ValidationError
+	require.True(t, errors.As(cfg.SetInt("daemon.port", 0), &ve))
+	require.Equal(t, "daemon.port", ve.Key)
+	require.Equal(t, int64(0), ve.Value)
+	require.Contains(t, ve.Err.Error(), "may not be less than 1")
+
+	_, err = cfg.Cast("daemon.port", "xxx")
+	require.True(t, errors.As(err, &ve))
+	require.Equal(t, "xxx", ve.Value)
+
+	// Errors found on open are typed too:
+	_, err = openFromString("daemon:\n  port: xxx\n", TestDefaults)
+	require.True(t, errors.As(err, &tme))
+	require.Equal(t, "daemon.port", tme.Key)
+}
@@ -0,0 +1,352 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ChangeOrigin describes what caused a change.
+type ChangeOrigin int
+
+const (
+	// OriginSet is used for changes done by Set() and friends.
+	OriginSet = ChangeOrigin(iota)
+	// OriginReload is used for changes done by Reload().
+	OriginReload
+	// OriginMerge is used for changes done by Merge().
+	OriginMerge
+	// OriginReset is used for changes done by Reset().
+	OriginReset
+)
+
+func (origin ChangeOrigin) String() string {
+	switch origin {
+	case OriginSet:
+		return "set"
+	case OriginReload:
+		return "reload"
+	case OriginMerge:
+		return "merge"
+	case OriginReset:
+		return "reset"
+	default:
+		return "unknown"
+	}
+}
+
+// ChangeKind tells if a key was modified, added or removed.
+type ChangeKind int
+
+const (
+	// ChangeModified is used when a key has a different value than before.
+	ChangeModified = ChangeKind(iota)
+	// ChangeAdded is used when a key was not there before,
+	// e.g. a new section below __many__.
+	ChangeAdded
+	// ChangeRemoved is used when a key is not there anymore.
+	ChangeRemoved
+)
+
+func (kind ChangeKind) String() string {
+	switch kind {
+	case ChangeModified:
+		return "modified"
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// Change describes the change of a single key.
+type Change struct {
+	// Key is the key that changed. If the callback was registered on a
+	// section, the key is relative to that section.
+	Key string
+
+	// Old is the value before the change.
+	Old interface{}
+
+	// New is the value after the change.
+	New interface{}
+
+	// Origin tells what kind of operation caused the change.
+	Origin ChangeOrigin
+
+	// Kind tells if the key was modified, added or removed.
+	Kind ChangeKind
+
+	// NeedsRestart is taken over from the default entry of the key.
+	NeedsRestart bool
+}
+
+func (change Change) String() string {
+	var desc string
+	switch change.Kind {
+	case ChangeAdded:
+		desc = fmt.Sprintf("%s: added (%v)", change.Key, change.New)
+	case ChangeRemoved:
+		desc = fmt.Sprintf("%s: removed (was %v)", change.Key, change.Old)
+	default:
+		desc = fmt.Sprintf("%s: %v -> %v", change.Key, change.Old, change.New)
+	}
+
+	if change.NeedsRestart {
+		desc += " (requires restart)"
+	}
+
+	return desc
+}
+
+// AddChangeEvent works like AddEvent(), but the callback gets a description
+// of the change, including the old and the new value. The returned id can
+// be used to unregister the callback with RemoveEvent().
+func (cfg *Config) AddChangeEvent(key string, fn func(change Change)) int {
+	return cfg.addEvent(keyChangedEvent{
+		changeFn: fn,
+		key:      key,
+	})
+}
+
+// pendingEvent is a callback that is about to be called
+// once the lock of the config is released.
+type pendingEvent struct {
+	event  keyChangedEvent
+	change Change
+}
+
+func (pe pendingEvent) fire() {
+	change := pe.change
+	if pe.event.section != "" {
+		change.Key = strings.TrimPrefix(change.Key, pe.event.section+".")
+	}
+
+	if pe.event.changeFn != nil {
+		pe.event.changeFn(change)
+		return
+	}
+
+	if pe.event.key == "" {
+		// Tell the catch-all callbacks what key changed:
+		pe.event.fn(change.Key)
+		return
+	}
+
+	pe.event.fn(pe.event.key)
+}
+
+// fireEvents calls all events. Do not call with any lock held.
+func fireEvents(events []pendingEvent) {
+	for _, event := range events {
+		event.fire()
+	}
+}
+
+// flattenMemory returns a map of all full keys in `memory` to their value.
+func flattenMemory(memory map[interface{}]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	keys(memory, nil, func(section map[interface{}]interface{}, key []string) error {
+		flat[strings.Join(key, ".")] = section[key[len(key)-1]]
+		return nil
+	})
+
+	return flat
+}
+
+// gatherChanges compares two versions of the memory of this config
+// and returns the callbacks of all keys that differ.
+// Call this with cfg.mu locked!
+func (cfg *Config) gatherChanges(oldMemory, newMemory map[interface{}]interface{}, origin ChangeOrigin) []pendingEvent {
+	events := []pendingEvent{}
+	for _, change := range cfg.memoryChanges(oldMemory, newMemory, origin) {
+		events = append(events, cfg.gatherCallbacks(change)...)
+	}
+
+	return events
+}
+
+// memoryChanges compares two versions of the memory of this config
+// and returns the changes of all keys that differ, sorted by key.
+func (cfg *Config) memoryChanges(oldMemory, newMemory map[interface{}]interface{}, origin ChangeOrigin) []Change {
+	oldFlat := flattenMemory(oldMemory)
+	newFlat := flattenMemory(newMemory)
+
+	allKeys := []string{}
+	for key := range newFlat {
+		allKeys = append(allKeys, key)
+	}
+
+	for key := range oldFlat {
+		if _, ok := newFlat[key]; !ok {
+			allKeys = append(allKeys, key)
+		}
+	}
+
+	sort.Strings(allKeys)
+
+	changes := []Change{}
+	for _, key := range allKeys {
+		oldVal := cfg.flatValue(oldFlat, key)
+		newVal := cfg.flatValue(newFlat, key)
+		if reflect.DeepEqual(oldVal, newVal) {
+			continue
+		}
+
+		kind := ChangeModified
+		if _, ok := oldFlat[key]; !ok {
+			kind = ChangeAdded
+		} else if _, ok := newFlat[key]; !ok {
+			kind = ChangeRemoved
+		}
+
+		changes = append(changes, Change{
+			Key:    key,
+			Old:    oldVal,
+			New:    newVal,
+			Origin: origin,
+			Kind:   kind,
+		})
+	}
+
+	return changes
+}
+
+// flatValue returns the value of `key` in `flat` or its default,
+// if it's not there (e.g. a section below __many__ that was removed)
+func (cfg *Config) flatValue(flat map[string]interface{}, key string) interface{} {
+	if val, ok := flat[key]; ok {
+		return val
+	}
+
+	if entry := cfg.index.entry(key); entry != nil {
+		return entry.Default
+	}
+
+	return nil
+}
+
+// isInSection checks if the full `key` is part of `section`.
+func isInSection(key, section string) bool {
+	return section == "" || strings.HasPrefix(key, section+".")
+}
+
+////////////
+
+// WatchBufferSize is the number of changes a channel returned by
+// Config.Watch() can hold before old changes are dropped.
+const WatchBufferSize = 64
+
+// changeWatcher delivers changes to a channel for Config.Watch().
+type changeWatcher struct {
+	mu      sync.Mutex
+	pattern []string
+	ch      chan Change
+	closed  bool
+}
+
+func (cw *changeWatcher) send(change Change) {
+	if !matchKeyPattern(cw.pattern, change.Key) {
+		return
+	}
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if cw.closed {
+		return
+	}
+
+	for {
+		select {
+		case cw.ch <- change:
+			return
+		default:
+			// Buffer is full; make room by dropping the oldest change.
+			select {
+			case <-cw.ch:
+			default:
+			}
+		}
+	}
+}
+
+func (cw *changeWatcher) close() {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	cw.closed = true
+	close(cw.ch)
+}
+
+// matchKeyPattern checks if `key` matches the split `pattern`.
+// An empty pattern matches every key.
+func matchKeyPattern(pattern []string, key string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+
+	split := strings.Split(key, ".")
+	if len(split) != len(pattern) {
+		return false
+	}
+
+	for idx, part := range pattern {
+		if part == "*" {
+			continue
+		}
+
+		if ok, err := path.Match(part, split[idx]); err != nil || !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Watch returns a channel that receives every change of a key matching
+// `keyPattern`. The pattern is either a key like "daemon.port" or may use a
+// "*" in place of a part of the key, like "mounts.*.path". An empty pattern
+// matches all keys. Like with AddEvent(), keys are relative to the section.
+//
+// The channel is buffered and holds up to WatchBufferSize changes. When the
+// receiver can't keep up and the buffer is full, the oldest change is dropped
+// in favour of the new one; the config is never blocked by a slow receiver.
+// Receivers that need the current value should therefore use the config
+// itself instead of relying on seeing every single change.
+//
+// Once `ctx` is cancelled, the watch is removed and the channel is closed.
+func (cfg *Config) Watch(ctx context.Context, keyPattern string) <-chan Change {
+	cw := &changeWatcher{
+		ch: make(chan Change, WatchBufferSize),
+	}
+
+	if keyPattern != "" {
+		cw.pattern = strings.Split(keyPattern, ".")
+		for _, part := range cw.pattern {
+			if _, err := path.Match(part, ""); err != nil {
+				complain(Complaint{
+					Kind: ComplaintInvalidKey,
+					Key:  keyPattern,
+					Msg:  fmt.Sprintf("bug: invalid key pattern: %v", keyPattern),
+				}, cfg.strictness)
+			}
+		}
+	}
+
+	id := cfg.AddChangeEvent("", cw.send)
+
+	go func() {
+		<-ctx.Done()
+		cfg.RemoveEvent(id)
+		cw.close()
+	}()
+
+	return cw.ch
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeEventSet(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	changes := []Change{}
+	cbID := cfg.AddChangeEvent("daemon.port", func(change Change) {
+		changes = append(changes, change)
+	})
+
+	require.Nil(t, cfg.SetInt("daemon.port", 42))
+	require.Nil(t, cfg.SetInt("daemon.port", 42))
+	require.Nil(t, cfg.SetString("data.ipfs.path", "y"))
+	require.Equal(t, []Change{{
+		Key:          "daemon.port",
+		Old:          int64(6667),
+		New:          int64(42),
+		Origin:       OriginSet,
+		NeedsRestart: true,
+	}}, changes)
+
+	cfg.RemoveEvent(cbID)
+	require.Nil(t, cfg.SetInt("daemon.port", 43))
+	require.Len(t, changes, 1)
+}
+
+func TestChangeEventAllKeys(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	keys := []string{}
+	cfg.AddChangeEvent("", func(change Change) {
+		keys = append(keys, change.Key)
+	})
+
+	legacyKeys := []string{}
+	cfg.AddEvent("", func(key string) {
+		legacyKeys = append(legacyKeys, key)
+	})
+
+	require.Nil(t, cfg.SetInt("daemon.port", 42))
+	require.Nil(t, cfg.SetString("data.ipfs.path", "y"))
+	require.Equal(t, []string{"daemon.port", "data.ipfs.path"}, keys)
+	require.Equal(t, keys, legacyKeys)
+}
+
+func TestChangeEventSection(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	fsSec := cfg.Section("fs")
+	changes := []Change{}
+	fsSec.AddChangeEvent("", func(change Change) {
+		changes = append(changes, change)
+	})
+
+	require.Nil(t, cfg.SetString("fs.compress.default_algo", "lz4"))
+	require.Nil(t, cfg.SetInt("daemon.port", 42))
+	require.Equal(t, []Change{{
+		Key:    "compress.default_algo",
+		Old:    "snappy",
+		New:    "lz4",
+		Origin: OriginSet,
+	}}, changes)
+}
+
+func TestChangeEventReload(t *testing.T) {
+	cfg, err := Open(nil, TestDefaultsV0, StrictnessPanic)
+	require.Nil(t, err)
+
+	changes := []Change{}
+	cfg.AddChangeEvent("", func(change Change) {
+		changes = append(changes, change)
+	})
+
+	text := `# version: 666
+a:
+  b: 70
+`
+
+	require.Nil(t, cfg.Reload(NewYamlDecoder(strings.NewReader(text))))
+	require.Equal(t, []Change{{
+		Key:    "a.b",
+		Old:    int64(15),
+		New:    int64(70),
+		Origin: OriginReload,
+	}}, changes)
+}
+
+func TestChangeEventMerge(t *testing.T) {
+	cfg, err := Open(nil, TestDefaultsV0, StrictnessPanic)
+	require.Nil(t, err)
+
+	other, err := Open(nil, TestDefaultsV0, StrictnessPanic)
+	require.Nil(t, err)
+	require.Nil(t, other.SetString("a.child.c", "world"))
+
+	changes := []Change{}
+	cfg.AddChangeEvent("a.child.c", func(change Change) {
+		changes = append(changes, change)
+	})
+
+	require.Nil(t, cfg.Merge(other))
+	require.Len(t, changes, 1)
+	require.Equal(t, "world", changes[0].New)
+	require.Equal(t, OriginMerge, changes[0].Origin)
+}
+
+func TestChangeEventReset(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	changes := []Change{}
+	cfg.AddChangeEvent("", func(change Change) {
+		changes = append(changes, change)
+	})
+
+	require.Nil(t, cfg.Reset("daemon.port"))
+	require.Nil(t, cfg.Reset("data"))
+	require.Equal(t, []Change{{
+		Key:          "daemon.port",
+		Old:          int64(6667),
+		New:          int64(6666),
+		Origin:       OriginReset,
+		NeedsRestart: true,
+	}, {
+		Key:          "data.ipfs.path",
+		Old:          "x",
+		New:          "",
+		Origin:       OriginReset,
+		NeedsRestart: true,
+	}}, changes)
+
+	// Nothing left to reset:
+	require.Nil(t, cfg.Reset(""))
+	require.Len(t, changes, 2)
+}
+
+func TestChangeOriginString(t *testing.T) {
+	require.Equal(t, "set", OriginSet.String())
+	require.Equal(t, "reload", OriginReload.String())
+	require.Equal(t, "merge", OriginMerge.String())
+	require.Equal(t, "reset", OriginReset.String())
+}
+
+func TestWatchChannel(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := cfg.Watch(ctx, "fs.*.default_algo")
+
+	require.Nil(t, cfg.SetInt("daemon.port", 42))
+	require.Nil(t, cfg.SetString("fs.compress.default_algo", "lz4"))
+
+	change := <-ch
+	require.Equal(t, "fs.compress.default_algo", change.Key)
+	require.Equal(t, "snappy", change.Old)
+	require.Equal(t, "lz4", change.New)
+
+	cancel()
+
+	// Channel must be closed eventually:
+	for range ch {
+	}
+
+	// Should not panic by sending to a closed channel:
+	require.Nil(t, cfg.SetString("fs.compress.default_algo", "none"))
+}
+
+func TestWatchChannelOverflow(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := cfg.Watch(ctx, "daemon.port")
+	for port := 1; port <= WatchBufferSize+10; port++ {
+		require.Nil(t, cfg.SetInt("daemon.port", int64(port)))
+	}
+
+	require.Len(t, ch, WatchBufferSize)
+
+	// The oldest changes should have been dropped:
+	change := <-ch
+	require.Equal(t, int64(11), change.New)
+}
+
+func TestMatchKeyPattern(t *testing.T) {
+	tcs := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"", "a.b.c", true},
+		{"a.b.c", "a.b.c", true},
+		{"a.*.c", "a.b.c", true},
+		{"a.b*.c", "a.bx.c", true},
+		{"a.*", "a.b.c", false},
+		{"a.b.c", "a.b.d", false},
+	}
+
+	for _, tc := range tcs {
+		var pattern []string
+		if tc.pattern != "" {
+			pattern = strings.Split(tc.pattern, ".")
+		}
+
+		require.Equal(t, tc.match, matchKeyPattern(pattern, tc.key), tc.pattern)
+	}
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	e "github.com/pkg/errors"
+)
+
+// listFlag is a flag.Value for list keys.
+// The items are separated by " ;; " like in Cast().
+type listFlag struct {
+	val   interface{}
+	parse func(s string) (interface{}, error)
+}
+
+func (lf *listFlag) String() string {
+	if lf == nil || lf.val == nil {
+		return ""
+	}
+
+	items := []string{}
+	rval := maybeMakeInterfaceList(lf.val).([]interface{})
+	for _, item := range rval {
+		items = append(items, fmt.Sprintf("%v", item))
+	}
+
+	return strings.Join(items, sliceSeparator)
+}
+
+func (lf *listFlag) Set(s string) error {
+	val, err := lf.parse(s)
+	if err != nil {
+		return err
+	}
+
+	lf.val = val
+	return nil
+}
+
+func (lf *listFlag) Get() interface{} {
+	return lf.val
+}
+
+func newListFlag(def interface{}) (*listFlag, error) {
+	lf := &listFlag{}
+	switch def.(type) {
+	case []string:
+		lf.parse = func(s string) (interface{}, error) { return castStringSlice(s) }
+	case []int64:
+		lf.parse = func(s string) (interface{}, error) { return castIntSlice(s) }
+	case []float64:
+		lf.parse = func(s string) (interface{}, error) { return castFloatSlice(s) }
+	case []bool:
+		lf.parse = func(s string) (interface{}, error) { return castBoolSlice(s) }
+	default:
+		return nil, fmt.Errorf("unsupported list type: %T", def)
+	}
+
+	lf.val = def
+	return lf, nil
+}
+
+// walkDefaults calls `fn` for every entry in `defaults`, sorted by key.
+// Sections below __many__ are skipped, since their names are not known.
+func walkDefaults(defaults DefaultMapping, prefix string, fn func(key string, entry DefaultEntry) error) error {
+	defaultKeys := []string{}
+	for keyVal := range defaults {
+		key, ok := keyVal.(string)
+		if !ok {
+			return fmt.Errorf("default key is not a string: %v", keyVal)
+		}
+
+		if key != manyMarker {
+			defaultKeys = append(defaultKeys, key)
+		}
+	}
+
+	sort.Strings(defaultKeys)
+
+	for _, key := range defaultKeys {
+		switch child := defaults[key].(type) {
+		case DefaultMapping:
+			if err := walkDefaults(child, prefixKey(prefix, key), fn); err != nil {
+				return err
+			}
+		case DefaultEntry:
+			if err := fn(prefixKey(prefix, key), child); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// BindFlags defines a flag on `fs` for every key in the defaults of `cfg`.
+// The name of the flag is the key (relative to the section of `cfg`),
+// the usage is the documentation of the key and the flag's default is the
+// default of the key. Lists are passed like in Cast(), separated by " ;; ".
+//
+// Keys below __many__ sections are skipped, since their names are only
+// known at runtime.  After parsing `fs`, call ApplyFlags() to take over
+// the flags that were given on the command line.
+func (cfg *Config) BindFlags(fs *flag.FlagSet) error {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+
+	defaults := cfg.index.section(cfg.section)
+	if defaults == nil {
+		return &InvalidKeyError{Key: cfg.section}
+	}
+
+	return walkDefaults(defaults, "", func(key string, entry DefaultEntry) error {
+		defType := getTypeOf(entry.Default)
+		def, err := generalizeType(maybeMakeInterfaceList(entry.Default), defType)
+		if err != nil {
+			return e.Wrapf(err, "default of %s", key)
+		}
+
+		switch val := def.(type) {
+		case bool:
+			fs.Bool(key, val, entry.Docs)
+		case int64:
+			fs.Int64(key, val, entry.Docs)
+		case float64:
+			fs.Float64(key, val, entry.Docs)
+		case string:
+			fs.String(key, val, entry.Docs)
+		default:
+			lf, err := newListFlag(val)
+			if err != nil {
+				return e.Wrapf(err, "default of %s", key)
+			}
+
+			fs.Var(lf, key, entry.Docs)
+		}
+
+		return nil
+	})
+}
+
+// ApplyFlags sets all keys of `cfg` whose flag was set on the command line.
+// `fs` must have been parsed already. Flags that do not belong to a key are
+// ignored. Each value needs to pass the validator of its key.
+//
+// Like with ApplyEnv(), the values taken from the flags are not saved by Save()
+// and are kept by Reload().
+func (cfg *Config) ApplyFlags(fs *flag.FlagSet) error {
+	if !fs.Parsed() {
+		return fmt.Errorf("flags were not parsed yet")
+	}
+
+	given := []*flag.Flag{}
+	fs.Visit(func(fl *flag.Flag) {
+		given = append(given, fl)
+	})
+
+	for _, fl := range given {
+		if !cfg.IsValidKey(fl.Name) {
+			continue
+		}
+
+		getter, ok := fl.Value.(flag.Getter)
+		if !ok {
+			return fmt.Errorf("flag %s has no usable value", fl.Name)
+		}
+
+		if err := cfg.override(fl.Name, getter.Get()); err != nil {
+			return e.Wrapf(err, "flag %s", fl.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var flagDefaults = DefaultMapping{
+	"daemon": DefaultMapping{
+		"port": DefaultEntry{
+			Default:   6666,
+			Docs:      "Port of the daemon process",
+			Validator: IntRangeValidator(1, 65536),
+		},
+		"hosts": DefaultEntry{
+			Default: []string{"localhost"},
+			Docs:    "Hosts to listen on",
+		},
+		"verbose": DefaultEntry{
+			Default: false,
+		},
+		"ratio": DefaultEntry{
+			Default: 0.5,
+		},
+	},
+	"mounts": DefaultMapping{
+		"__many__": DefaultMapping{
+			"path": DefaultEntry{
+				Default: "",
+			},
+		},
+	},
+}
+
+func newTestFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+func TestBindFlags(t *testing.T) {
+	cfg, err := Open(nil, flagDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	fs := newTestFlagSet()
+	require.Nil(t, cfg.BindFlags(fs))
+
+	names := []string{}
+	fs.VisitAll(func(fl *flag.Flag) {
+		names = append(names, fl.Name)
+	})
+
+	require.Equal(t, []string{
+		"daemon.hosts",
+		"daemon.port",
+		"daemon.ratio",
+		"daemon.verbose",
+	}, names)
+
+	port := fs.Lookup("daemon.port")
+	require.Equal(t, "6666", port.DefValue)
+	require.Equal(t, "Port of the daemon process", port.Usage)
+	require.Equal(t, "localhost", fs.Lookup("daemon.hosts").DefValue)
+}
+
+func TestApplyFlags(t *testing.T) {
+	cfg, err := openFromString("daemon:\n  port: 7777\n", flagDefaults)
+	require.Nil(t, err)
+
+	fs := newTestFlagSet()
+	fs.String("unrelated", "", "not a config key")
+	require.Nil(t, cfg.BindFlags(fs))
+	require.Nil(t, fs.Parse([]string{
+		"-daemon.hosts", "a ;; b",
+		"-daemon.verbose",
+		"-daemon.ratio", "0.75",
+		"-unrelated", "x",
+	}))
+
+	require.Nil(t, cfg.ApplyFlags(fs))
+	require.Equal(t, []string{"a", "b"}, cfg.Strings("daemon.hosts"))
+	require.Equal(t, true, cfg.Bool("daemon.verbose"))
+	require.Equal(t, 0.75, cfg.Float("daemon.ratio"))
+
+	// Flags that were not given should not overwrite the config:
+	require.Equal(t, int64(7777), cfg.Int("daemon.port"))
+
+	// Flags should not be saved:
+	buf := &bytes.Buffer{}
+	require.Nil(t, cfg.Save(NewYamlEncoder(buf)))
+	require.NotContains(t, buf.String(), "verbose: true")
+}
+
+func TestApplyFlagsInvalid(t *testing.T) {
+	cfg, err := Open(nil, flagDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	fs := newTestFlagSet()
+	require.Nil(t, cfg.BindFlags(fs))
+	require.NotNil(t, cfg.ApplyFlags(fs))
+
+	// Does not pass the validator:
+	require.Nil(t, fs.Parse([]string{"-daemon.port", "0"}))
+	require.NotNil(t, cfg.ApplyFlags(fs))
+	require.Equal(t, int64(6666), cfg.Int("daemon.port"))
+
+	// Not an int, so parsing should fail already:
+	fs = newTestFlagSet()
+	require.Nil(t, cfg.BindFlags(fs))
+	require.NotNil(t, fs.Parse([]string{"-daemon.port", "xxx"}))
+}
+
+func TestBindFlagsSection(t *testing.T) {
+	cfg, err := Open(nil, flagDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	fs := newTestFlagSet()
+	daemonSec := cfg.Section("daemon")
+	require.Nil(t, daemonSec.BindFlags(fs))
+	require.NotNil(t, fs.Lookup("port"))
+	require.Nil(t, fs.Parse([]string{"-port", "1234"}))
+	require.Nil(t, daemonSec.ApplyFlags(fs))
+	require.Equal(t, int64(1234), cfg.Int("daemon.port"))
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxResolvedKeys is the number of keys below __many__ sections a keyIndex
+// remembers. Once there are more, it starts over, so keys coming from
+// untrusted sources can't grow it without bounds.
+const maxResolvedKeys = 4096
+
+// keyIndex is a flat view of a DefaultMapping. It is built once when a
+// config is opened, so the accessors do not need to split keys and walk the
+// defaults on every call. Keys below placeholder sections are stored with
+// __many__ in place of the section name (e.g. "mounts.__many__.path").
+type keyIndex struct {
+	entries  map[string]*DefaultEntry
+	sections map[string]DefaultMapping
+
+	// resolved maps keys of named __many__ sections to their template key.
+	// Only keys that were found are remembered, up to maxResolvedKeys.
+	resolved      atomic.Pointer[sync.Map]
+	resolvedCount atomic.Int64
+}
+
+func newKeyIndex(defaults DefaultMapping) (*keyIndex, error) {
+	ki := &keyIndex{
+		entries:  make(map[string]*DefaultEntry),
+		sections: make(map[string]DefaultMapping),
+	}
+
+	ki.resolved.Store(&sync.Map{})
+
+	if err := ki.add(defaults, ""); err != nil {
+		return nil, err
+	}
+
+	return ki, nil
+}
+
+func (ki *keyIndex) add(defaults DefaultMapping, prefix string) error {
+	ki.sections[prefix] = defaults
+	for keyVal, child := range defaults {
+		key, ok := keyVal.(string)
+		if !ok {
+			return fmt.Errorf("default key is not a string: %v", keyVal)
+		}
+
+		fullKey := prefixKey(prefix, key)
+		switch value := child.(type) {
+		case DefaultMapping:
+			if err := ki.add(value, fullKey); err != nil {
+				return err
+			}
+		case DefaultEntry:
+			if key == manyMarker {
+				return fmt.Errorf("__many__ used for default entries: %s", fullKey)
+			}
+
+			ki.entries[fullKey] = &value
+		}
+	}
+
+	return nil
+}
+
+// has checks if `key` is a known entry or section.
+func (ki *keyIndex) has(key string) bool {
+	if _, ok := ki.entries[key]; ok {
+		return true
+	}
+
+	_, ok := ki.sections[key]
+	return ok
+}
+
+// template returns the key in the index that describes the full `key`.
+// For most keys this is `key` itself; keys below named __many__ sections
+// have __many__ in place of the name.
+func (ki *keyIndex) template(key string) (string, bool) {
+	if ki.has(key) {
+		return key, true
+	}
+
+	if template, ok := ki.resolved.Load().Load(key); ok {
+		return template.(string), true
+	}
+
+	template := ""
+	for _, part := range strings.Split(key, ".") {
+		next := prefixKey(template, part)
+		if !ki.has(next) {
+			// The key might still be used if we have a __many__ entry.
+			next = prefixKey(template, manyMarker)
+			if _, ok := ki.sections[next]; !ok {
+				return "", false
+			}
+		}
+
+		template = next
+	}
+
+	ki.remember(key, template)
+	return template, true
+}
+
+// remember stores the `template` of `key` for later calls of template().
+func (ki *keyIndex) remember(key, template string) {
+	if ki.resolvedCount.Load() >= maxResolvedKeys {
+		ki.resolved.Store(&sync.Map{})
+		ki.resolvedCount.Store(0)
+	}
+
+	if _, loaded := ki.resolved.Load().LoadOrStore(key, template); !loaded {
+		ki.resolvedCount.Add(1)
+	}
+}
+
+// entry returns the default entry of the full `key` or nil.
+func (ki *keyIndex) entry(key string) *DefaultEntry {
+	if entry, ok := ki.entries[key]; ok {
+		return entry
+	}
+
+	template, ok := ki.template(key)
+	if !ok {
+		return nil
+	}
+
+	return ki.entries[template]
+}
+
+// section returns the default section at the full `key` or nil.
+// An empty `key` returns the root of the defaults.
+func (ki *keyIndex) section(key string) DefaultMapping {
+	if section, ok := ki.sections[key]; ok {
+		return section
+	}
+
+	template, ok := ki.template(key)
+	if !ok {
+		return nil
+	}
+
+	return ki.sections[template]
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testManyDefaults = DefaultMapping{
+	"mounts": DefaultMapping{
+		"__many__": DefaultMapping{
+			"path": DefaultEntry{
+				Default: "",
+			},
+			"options": DefaultMapping{
+				"read_only": DefaultEntry{
+					Default: false,
+				},
+			},
+		},
+		"default": DefaultMapping{
+			"path": DefaultEntry{
+				Default: "/",
+			},
+		},
+	},
+}
+
+func TestKeyIndex(t *testing.T) {
+	ki, err := newKeyIndex(testManyDefaults)
+	require.Nil(t, err)
+
+	require.Equal(t, "/", ki.entry("mounts.default.path").Default)
+	require.Equal(t, "", ki.entry("mounts.music.path").Default)
+	require.Equal(t, false, ki.entry("mounts.music.options.read_only").Default)
+	require.Equal(t, "", ki.entry("mounts.__many__.path").Default)
+
+	require.Nil(t, ki.entry("mounts"))
+	require.Nil(t, ki.entry("mounts.music"))
+	require.Nil(t, ki.entry("mounts.music.path.sub"))
+	require.Nil(t, ki.entry("mounts.default.options.read_only"))
+	require.Nil(t, ki.entry("not.existing"))
+
+	require.Equal(t, testManyDefaults, ki.section(""))
+	require.NotNil(t, ki.section("mounts.music.options"))
+	require.Nil(t, ki.section("mounts.music.path"))
+
+	template, ok := ki.template("mounts.music.options.read_only")
+	require.True(t, ok)
+	require.Equal(t, "mounts.__many__.options.read_only", template)
+}
+
+func TestKeyIndexBounded(t *testing.T) {
+	ki, err := newKeyIndex(testManyDefaults)
+	require.Nil(t, err)
+
+	for idx := 0; idx < 3*maxResolvedKeys; idx++ {
+		require.NotNil(t, ki.entry(fmt.Sprintf("mounts.m%d.path", idx)))
+		require.Nil(t, ki.entry(fmt.Sprintf("not.existing%d", idx)))
+		require.True(t, ki.resolvedCount.Load() <= maxResolvedKeys)
+	}
+
+	count := 0
+	ki.resolved.Load().Range(func(key, val interface{}) bool {
+		count++
+		return true
+	})
+
+	require.True(t, count <= maxResolvedKeys)
+}
+
+func TestKeyIndexBadDefaults(t *testing.T) {
+	_, err := newKeyIndex(DefaultMapping{
+		"a": DefaultMapping{
+			1: DefaultEntry{Default: 1},
+		},
+	})
+	require.NotNil(t, err)
+}
+
+func TestGetDoesNotAllocate(t *testing.T) {
+	cfg, err := Open(nil, testManyDefaults, StrictnessPanic)
+	require.Nil(t, err)
+	require.Nil(t, cfg.SetString("mounts.music.path", "/music"))
+
+	for _, key := range []string{
+		"mounts.default.path",
+		"mounts.music.path",
+		"mounts.music.options.read_only",
+	} {
+		// Warm up the index for keys below __many__:
+		cfg.Get(key)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			cfg.Get(key)
+		})
+
+		require.Equal(t, 0.0, allocs, key)
+	}
+}
+
+func TestTypedGettersDoNotAllocate(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+	require.Nil(t, cfg.SetInt("daemon.port", 7777))
+
+	daemon := cfg.Section("daemon")
+	compress := cfg.Section("fs.compress")
+	for name, get := range map[string]func(){
+		"int":            func() { cfg.Int("daemon.port") },
+		"string":         func() { cfg.String("fs.compress.default_algo") },
+		"section int":    func() { daemon.Int("port") },
+		"section string": func() { compress.String("default_algo") },
+	} {
+		require.Equal(t, 0.0, testing.AllocsPerRun(100, get), name)
+	}
+}
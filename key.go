@@ -0,0 +1,164 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// KeyType lists all types a typed key can have.
+type KeyType interface {
+	bool | string | int64 | float64 | time.Duration |
+		[]bool | []string | []int64 | []float64 | []time.Duration
+}
+
+// TypedKey is a handle for a single key with a fixed type.
+// Create it with Key().
+type TypedKey[T KeyType] struct {
+	key string
+}
+
+// keyCheck is the cache key of Config.keyChecks.
+type keyCheck struct {
+	key string
+	typ reflect.Type
+}
+
+// Key returns a handle for `key` with the type T. It is meant to be defined
+// once as package level variable next to the defaults:
+//
+//	var Port = config.Key[int64](Defaults, "daemon.port")
+//
+//	// later:
+//	port := Port.Get(cfg)
+//
+// Only types supported by the config can be used as T, so using an unsupported
+// type fails to compile. If `key` is not part of `defaults` or T does not match
+// its default, Key panics, so the mistake shows up at startup. The key is
+// relative to `defaults`; to use it on a section, pass the defaults of that
+// section. Get() and Set() check once per config that its defaults agree.
+// Durations are stored as strings, so use T = string to get the raw value.
+func Key[T KeyType](defaults DefaultMapping, key string) TypedKey[T] {
+	tk := TypedKey[T]{key: key}
+	if err := tk.Check(defaults); err != nil {
+		panic(fmt.Sprintf("config: bad typed key: %v", err))
+	}
+
+	return tk
+}
+
+// Name returns the key of the handle.
+func (tk TypedKey[T]) Name() string {
+	return tk.key
+}
+
+// Check checks if T matches the type of the key in `defaults`. This can be
+// used to check all handles at startup, even before opening a config.
+func (tk TypedKey[T]) Check(defaults DefaultMapping) error {
+	return checkKeyType(tk.key, reflect.TypeOf((*T)(nil)).Elem(), defaults)
+}
+
+func checkKeyType(key string, typ reflect.Type, defaults DefaultMapping) error {
+	entry := getDefaultByKey(key, defaults, StrictnessIgnore)
+	if entry == nil {
+		return &InvalidKeyError{Key: key}
+	}
+
+	want, err := generalizeType(maybeMakeInterfaceList(entry.Default), getTypeOf(entry.Default))
+	if err != nil {
+		return err
+	}
+
+	got, err := configZero(typ)
+	if err != nil {
+		return err
+	}
+
+	if reflect.TypeOf(want) != reflect.TypeOf(got) {
+		return &TypeMismatchError{
+			Key:  key,
+			Want: getTypeOf(entry.Default),
+			Got:  typ.String(),
+		}
+	}
+
+	return nil
+}
+
+// check does the type check for `cfg` and remembers the result.
+// It does not need the lock, since the defaults never change.
+func (tk TypedKey[T]) check(cfg *Config) error {
+	fullKey := prefixKey(cfg.section, tk.key)
+	cacheKey := keyCheck{key: fullKey, typ: reflect.TypeOf((*T)(nil)).Elem()}
+	if cfg.keyChecks != nil {
+		if err, ok := cfg.keyChecks.Load(cacheKey); ok {
+			if err == nil {
+				return nil
+			}
+
+			return err.(error)
+		}
+	}
+
+	err := checkKeyType(fullKey, cacheKey.typ, cfg.defaults)
+	if cfg.keyChecks != nil {
+		cfg.keyChecks.Store(cacheKey, err)
+	}
+
+	return err
+}
+
+// complain reports a failed check of the handle.
+func (tk TypedKey[T]) complain(cfg *Config, err error) {
+	kind := ComplaintWrongType
+	if _, ok := err.(*InvalidKeyError); ok {
+		kind = ComplaintInvalidKey
+	}
+
+	complain(Complaint{
+		Kind: kind,
+		Key:  prefixKey(cfg.section, tk.key),
+		Msg:  fmt.Sprintf("bug: %v", err),
+	}, cfg.strictness)
+}
+
+// Get returns the value of the key in `cfg`. Like with the typed getters of
+// Config, the key is relative to the section of `cfg`. If the key does not
+// exist or has another type, the config complains and the zero value is
+// returned.
+func (tk TypedKey[T]) Get(cfg *Config) T {
+	var result T
+	if err := tk.check(cfg); err != nil {
+		tk.complain(cfg, err)
+		return result
+	}
+
+	// Like the other getters, read from the current snapshot without locking:
+	val := cfg.getFrom(cfg.state.snapshot(), tk.key)
+	if err := assignValue(reflect.ValueOf(&result).Elem(), val); err != nil {
+		complain(Complaint{
+			Kind: ComplaintInvalidValue,
+			Key:  prefixKey(cfg.section, tk.key),
+			Msg:  fmt.Sprintf("invalid value: %v", err),
+		}, cfg.strictness)
+	}
+
+	return result
+}
+
+// Set sets the key in `cfg` to `val`. See Config.Set() for details.
+func (tk TypedKey[T]) Set(cfg *Config, val T) error {
+	if err := tk.check(cfg); err != nil {
+		tk.complain(cfg, err)
+		return err
+	}
+
+	switch v := interface{}(val).(type) {
+	case time.Duration:
+		return cfg.SetDuration(tk.key, v)
+	case []time.Duration:
+		return cfg.SetDurations(tk.key, v)
+	default:
+		return cfg.setLocked(tk.key, val)
+	}
+}
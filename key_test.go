@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testPortKey    = Key[int64](testStructDefaults, "daemon.port")
+	testTimeoutKey = Key[time.Duration](testStructDefaults, "daemon.timeout")
+	testBackoffKey = Key[[]time.Duration](testStructDefaults, "daemon.backoff")
+	testHostsKey   = Key[[]string](testStructDefaults, "daemon.hosts")
+	testMountKey   = Key[string](testStructDefaults, "mounts.music.path")
+	testRatioKey   = Key[float64](testStructDefaults, "daemon.ratio")
+
+	// Those can't be created with Key(), since they are wrong:
+	testWrongKey    = TypedKey[string]{key: "daemon.port"}
+	testNotExisting = TypedKey[bool]{key: "not.existing"}
+)
+
+func TestTypedKey(t *testing.T) {
+	cfg, err := Open(nil, testStructDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	require.Equal(t, int64(6666), testPortKey.Get(cfg))
+	require.Equal(t, 5*time.Second, testTimeoutKey.Get(cfg))
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Second}, testBackoffKey.Get(cfg))
+	require.Equal(t, []string{"localhost"}, testHostsKey.Get(cfg))
+	require.Equal(t, "", testMountKey.Get(cfg))
+
+	require.Nil(t, testPortKey.Set(cfg, 8080))
+	require.Nil(t, testTimeoutKey.Set(cfg, time.Minute))
+	require.Nil(t, testBackoffKey.Set(cfg, []time.Duration{time.Hour}))
+	require.Nil(t, testMountKey.Set(cfg, "/music"))
+
+	require.Equal(t, int64(8080), cfg.Int("daemon.port"))
+	require.Equal(t, "1m0s", cfg.String("daemon.timeout"))
+	require.Equal(t, []time.Duration{time.Hour}, testBackoffKey.Get(cfg))
+	require.Equal(t, "/music", testMountKey.Get(cfg))
+
+	// Keys are relative to sections:
+	daemonDefaults := testStructDefaults["daemon"].(DefaultMapping)
+	require.Equal(t, int64(8080), Key[int64](daemonDefaults, "port").Get(cfg.Section("daemon")))
+}
+
+func TestTypedKeyCreation(t *testing.T) {
+	require.Panics(t, func() { Key[string](testStructDefaults, "daemon.port") })
+	require.Panics(t, func() { Key[bool](testStructDefaults, "not.existing") })
+
+	// The handle is relative to the defaults it was checked against:
+	require.Panics(t, func() { Key[int64](testStructDefaults, "port") })
+}
+
+func TestTypedKeyNumberConversion(t *testing.T) {
+	cfg, err := openFromString("daemon:\n  ratio: 1\n", testStructDefaults)
+	require.Nil(t, err)
+
+	require.Equal(t, 1.0, testRatioKey.Get(cfg))
+	require.Equal(t, 1.0, cfg.Float("daemon.ratio"))
+}
+
+func TestTypedKeyCheck(t *testing.T) {
+	require.Nil(t, testPortKey.Check(testStructDefaults))
+	require.Nil(t, testTimeoutKey.Check(testStructDefaults))
+	require.Nil(t, testMountKey.Check(testStructDefaults))
+
+	var tme *TypeMismatchError
+	require.True(t, errors.As(testWrongKey.Check(testStructDefaults), &tme))
+	require.Equal(t, "daemon.port", tme.Key)
+
+	var ike *InvalidKeyError
+	require.True(t, errors.As(testNotExisting.Check(testStructDefaults), &ike))
+
+	cfg, err := Open(nil, testStructDefaults, StrictnessPanic)
+	require.Nil(t, err)
+	require.Panics(t, func() { testWrongKey.Get(cfg) })
+	require.Panics(t, func() { testNotExisting.Set(cfg, true) })
+
+	cfg, err = Open(nil, testStructDefaults, StrictnessIgnore)
+	require.Nil(t, err)
+	require.Equal(t, "", testWrongKey.Get(cfg))
+	require.True(t, errors.As(testWrongKey.Set(cfg, "x"), &tme))
+}
+
+// BenchmarkTypedKeyGet should scale like BenchmarkGetScaling, since typed
+// keys read without locking too.
+func BenchmarkTypedKeyGet(b *testing.B) {
+	cfg, err := Open(nil, testStructDefaults, StrictnessPanic)
+	require.Nil(b, err)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			testPortKey.Get(cfg)
+		}
+	})
+}
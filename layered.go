@@ -0,0 +1,214 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Layered stacks several configs on top of each other. All of them have to
+// use the same defaults. A typical stack might look like this (from the
+// lowest to the highest layer):
+//
+//	/etc/app.yml -> ~/.config/app.yml -> ./app.yml -> runtime changes
+//
+// When getting a key, the highest layer that set the key explicitly wins.
+// If no layer did, the default is returned. Unlike Merge(), every layer
+// stays separate and can be modified and saved on its own.
+type Layered struct {
+	mu sync.Mutex
+
+	layers        []*Config
+	callbackCount int
+	// maps the id returned by AddEvent to the ids of each layer:
+	callbacks map[int][]int
+}
+
+// NewLayered creates a new layered config from `layers`.
+// The first layer is the lowest, the last one the highest.
+// The layers may not be sections and need to share the same defaults.
+func NewLayered(layers ...*Config) (*Layered, error) {
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("need at least one layer")
+	}
+
+	for idx, layer := range layers {
+		if layer.section != "" {
+			return nil, fmt.Errorf("layer %d is a section", idx)
+		}
+
+		if !reflect.DeepEqual(layers[0].defaults, layer.defaults) {
+			return nil, fmt.Errorf("refusing to stack configs with different defaults")
+		}
+	}
+
+	return &Layered{
+		layers:    layers,
+		callbacks: make(map[int][]int),
+	}, nil
+}
+
+// Len returns the number of layers.
+func (lc *Layered) Len() int {
+	return len(lc.layers)
+}
+
+// Layer returns the config at `idx`; zero is the lowest layer.
+// It can be used to modify, reload or save a single layer.
+func (lc *Layered) Layer(idx int) *Config {
+	return lc.layers[idx]
+}
+
+// Source returns the index of the layer that `key` is taken from.
+// If no layer set the key explicitly, -1 is returned.
+func (lc *Layered) Source(key string) int {
+	for idx := len(lc.layers) - 1; idx >= 0; idx-- {
+		if lc.layers[idx].isExplicit(key) {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// resolve returns the config that holds the value of `key`.
+// The lowest layer is used to return defaults.
+func (lc *Layered) resolve(key string) *Config {
+	if idx := lc.Source(key); idx >= 0 {
+		return lc.layers[idx]
+	}
+
+	return lc.layers[0]
+}
+
+// Set sets `key` to `val` in the layer at index `layer`.
+func (lc *Layered) Set(layer int, key string, val interface{}) error {
+	return lc.layers[layer].Set(key, val)
+}
+
+// Keys returns all keys of all layers.
+func (lc *Layered) Keys() []string {
+	seen := make(map[string]bool)
+	allKeys := []string{}
+	for _, layer := range lc.layers {
+		for _, key := range layer.Keys() {
+			if !seen[key] {
+				seen[key] = true
+				allKeys = append(allKeys, key)
+			}
+		}
+	}
+
+	sort.Strings(allKeys)
+	return allKeys
+}
+
+// AddEvent registers a callback that is called when the effective value
+// of `key` might have changed. This is the case when a layer changes `key`
+// and no higher layer set it explicitly. Like with Config.AddEvent(), an
+// empty key registers the callback for all keys. The returned id can be
+// passed to RemoveEvent().
+func (lc *Layered) AddEvent(key string, fn func(key string)) int {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	layerIDs := []int{}
+	for idx, layer := range lc.layers {
+		layerIdx := idx
+		layerIDs = append(layerIDs, layer.AddEvent(key, func(changedKey string) {
+			if lc.isShadowed(layerIdx, changedKey) {
+				return
+			}
+
+			fn(changedKey)
+		}))
+	}
+
+	id := lc.callbackCount
+	lc.callbacks[id] = layerIDs
+	lc.callbackCount++
+	return id
+}
+
+// RemoveEvent removes a callback previously registered with AddEvent().
+func (lc *Layered) RemoveEvent(id int) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	for idx, layerID := range lc.callbacks[id] {
+		lc.layers[idx].RemoveEvent(layerID)
+	}
+
+	delete(lc.callbacks, id)
+}
+
+// isShadowed checks if a layer above `idx` sets `key`.
+func (lc *Layered) isShadowed(idx int, key string) bool {
+	for _, layer := range lc.layers[idx+1:] {
+		if layer.isExplicit(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+////////////
+
+// Get returns the raw value at `key` of the highest layer that set it.
+// See Config.Get() for details.
+func (lc *Layered) Get(key string) interface{} {
+	return lc.resolve(key).Get(key)
+}
+
+// Bool returns the boolean value at `key` of the highest layer that set it.
+func (lc *Layered) Bool(key string) bool {
+	return lc.resolve(key).Bool(key)
+}
+
+// String returns the string value at `key` of the highest layer that set it.
+func (lc *Layered) String(key string) string {
+	return lc.resolve(key).String(key)
+}
+
+// Int returns the int value at `key` of the highest layer that set it.
+func (lc *Layered) Int(key string) int64 {
+	return lc.resolve(key).Int(key)
+}
+
+// Float returns the float value at `key` of the highest layer that set it.
+func (lc *Layered) Float(key string) float64 {
+	return lc.resolve(key).Float(key)
+}
+
+// Duration returns the duration value at `key` of the highest layer that set it.
+func (lc *Layered) Duration(key string) time.Duration {
+	return lc.resolve(key).Duration(key)
+}
+
+// Strings returns the string list at `key` of the highest layer that set it.
+func (lc *Layered) Strings(key string) []string {
+	return lc.resolve(key).Strings(key)
+}
+
+// Ints returns the int list at `key` of the highest layer that set it.
+func (lc *Layered) Ints(key string) []int64 {
+	return lc.resolve(key).Ints(key)
+}
+
+// Floats returns the float list at `key` of the highest layer that set it.
+func (lc *Layered) Floats(key string) []float64 {
+	return lc.resolve(key).Floats(key)
+}
+
+// Bools returns the boolean list at `key` of the highest layer that set it.
+func (lc *Layered) Bools(key string) []bool {
+	return lc.resolve(key).Bools(key)
+}
+
+// Durations returns the duration list at `key` of the highest layer that set it.
+func (lc *Layered) Durations(key string) []time.Duration {
+	return lc.resolve(key).Durations(key)
+}
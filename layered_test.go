@@ -0,0 +1,97 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func openLayers(t *testing.T, datas ...string) *Layered {
+	layers := []*Config{}
+	for _, data := range datas {
+		cfg, err := openFromString(data, TestDefaults)
+		require.Nil(t, err)
+		layers = append(layers, cfg)
+	}
+
+	lc, err := NewLayered(layers...)
+	require.Nil(t, err)
+	return lc
+}
+
+func TestLayeredGet(t *testing.T) {
+	lc := openLayers(
+		t,
+		"daemon:\n  port: 1000\nrepo:\n  current_user: sys\n",
+		"daemon:\n  port: 2000\n",
+		"",
+	)
+
+	require.Equal(t, 3, lc.Len())
+	require.Equal(t, int64(2000), lc.Int("daemon.port"))
+	require.Equal(t, 1, lc.Source("daemon.port"))
+	require.Equal(t, "sys", lc.String("repo.current_user"))
+	require.Equal(t, 0, lc.Source("repo.current_user"))
+	require.Equal(t, "snappy", lc.String("fs.compress.default_algo"))
+	require.Equal(t, -1, lc.Source("fs.compress.default_algo"))
+
+	require.Nil(t, lc.Set(2, "daemon.port", int64(3000)))
+	require.Equal(t, int64(3000), lc.Int("daemon.port"))
+	require.Equal(t, 2, lc.Source("daemon.port"))
+
+	// The lower layers are still intact:
+	require.Equal(t, int64(2000), lc.Layer(1).Int("daemon.port"))
+	require.Equal(t, int64(1000), lc.Layer(0).Int("daemon.port"))
+
+	// Resetting the highest layer uncovers the lower one again:
+	require.Nil(t, lc.Layer(2).Reset("daemon.port"))
+	require.Equal(t, int64(2000), lc.Int("daemon.port"))
+	require.Equal(t, 1, lc.Source("daemon.port"))
+}
+
+func TestLayeredEvents(t *testing.T) {
+	lc := openLayers(t, "", "daemon:\n  port: 2000\n")
+
+	changed := []string{}
+	id := lc.AddEvent("", func(key string) {
+		changed = append(changed, key)
+	})
+
+	// Shadowed by the higher layer:
+	require.Nil(t, lc.Set(0, "daemon.port", int64(1000)))
+	require.Empty(t, changed)
+
+	// Not shadowed:
+	require.Nil(t, lc.Set(0, "repo.current_user", "bob"))
+	require.Equal(t, []string{"repo.current_user"}, changed)
+
+	require.Nil(t, lc.Set(1, "daemon.port", int64(3000)))
+	require.Equal(t, []string{"repo.current_user", "daemon.port"}, changed)
+
+	// Reloading the higher layer uncovers the lower layer:
+	require.Nil(t, lc.Layer(1).Reload(NewYamlDecoder(strings.NewReader(""))))
+	require.Equal(t, []string{"repo.current_user", "daemon.port", "daemon.port"}, changed)
+	require.Equal(t, int64(1000), lc.Int("daemon.port"))
+
+	lc.RemoveEvent(id)
+	require.Nil(t, lc.Set(0, "repo.current_user", "alice"))
+	require.Len(t, changed, 3)
+}
+
+func TestLayeredDifferentDefaults(t *testing.T) {
+	a, err := Open(nil, TestDefaultsV0, StrictnessPanic)
+	require.Nil(t, err)
+
+	b, err := Open(nil, TestDefaultsV1, StrictnessPanic)
+	require.Nil(t, err)
+
+	_, err = NewLayered(a, b)
+	require.NotNil(t, err)
+
+	_, err = NewLayered(a, a.Section("a"))
+	require.NotNil(t, err)
+
+	_, err = NewLayered()
+	require.NotNil(t, err)
+}
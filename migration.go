@@ -116,7 +116,7 @@ func (mm *Migrater) Migrate(dec Decoder) (*Config, error) {
 	}
 
 	// TODO
-	cfg, err := open(currVersion, memory, currMig.defaults, mm.strictness)
+	cfg, err := open(currVersion, memory, decoderPositions(dec), currMig.defaults, mm.strictness)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChangeReport summarizes the changes done by ReloadWithReport() or
+// MergeWithReport(). The keys are relative to the section of the config.
+type ChangeReport struct {
+	// Live are the changes that took effect immediately.
+	Live []Change
+
+	// Restart are the changes to keys with NeedsRestart set.
+	// The application has to be restarted to pick those up.
+	Restart []Change
+}
+
+// Changes returns the number of keys that changed.
+func (report ChangeReport) Changes() int {
+	return len(report.Live) + len(report.Restart)
+}
+
+// NeedsRestart returns true if any key changed that requires a restart.
+func (report ChangeReport) NeedsRestart() bool {
+	return len(report.Restart) > 0
+}
+
+// LiveKeys returns the keys that changed without needing a restart.
+func (report ChangeReport) LiveKeys() []string {
+	return changedKeys(report.Live)
+}
+
+// RestartKeys returns the keys that changed, but need a restart.
+func (report ChangeReport) RestartKeys() []string {
+	return changedKeys(report.Restart)
+}
+
+func (report ChangeReport) String() string {
+	desc := fmt.Sprintf("%d keys changed", report.Changes())
+	if report.NeedsRestart() {
+		desc += "; restart required for: " + strings.Join(report.RestartKeys(), ", ")
+	}
+
+	return desc
+}
+
+func changedKeys(changes []Change) []string {
+	keys := []string{}
+	for _, change := range changes {
+		keys = append(keys, change.Key)
+	}
+
+	return keys
+}
+
+// needsRestart checks if the default entry of the full `key` has
+// NeedsRestart set.
+func (cfg *Config) needsRestart(key string) bool {
+	if entry := cfg.index.entry(key); entry != nil {
+		return entry.NeedsRestart
+	}
+
+	return false
+}
+
+// newReport sorts `changes` (with full keys) into a report.
+func (cfg *Config) newReport(changes []Change) ChangeReport {
+	report := ChangeReport{
+		Live:    []Change{},
+		Restart: []Change{},
+	}
+
+	for _, change := range changes {
+		if !isInSection(change.Key, cfg.section) {
+			// The whole config changed, but only the section is reported.
+			continue
+		}
+
+		change.NeedsRestart = cfg.needsRestart(change.Key)
+		if cfg.section != "" {
+			change.Key = strings.TrimPrefix(change.Key, cfg.section+".")
+		}
+
+		if change.NeedsRestart {
+			report.Restart = append(report.Restart, change)
+		} else {
+			report.Live = append(report.Live, change)
+		}
+	}
+
+	return report
+}
+
+// PendingRestart returns all keys with NeedsRestart set whose value differs
+// from the value they had when the application started, sorted by key.
+// This is the time the config was opened or MarkStarted() was called last.
+// The keys are relative to the section of `cfg`.
+func (cfg *Config) PendingRestart() []string {
+	changes := cfg.diffValues(
+		cfg.sectionValues(cfg.started.snapshot()),
+		cfg.sectionValues(cfg.state.snapshot()),
+	)
+
+	keys := []string{}
+	for _, change := range changes {
+		if change.NeedsRestart {
+			keys = append(keys, change.Key)
+		}
+	}
+
+	return keys
+}
+
+// MarkStarted remembers the current values as the ones the application
+// started with. PendingRestart() compares against those. It's only needed
+// when keys that require a restart were changed after opening the config
+// but before they were used, e.g. by ApplyEnv() or ApplyFlags().
+func (cfg *Config) MarkStarted() {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+
+	cfg.started.storeSnapshot(cfg.state.snapshot())
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadWithReport(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	newConfig := `daemon:
+  port: 7777
+data:
+  ipfs:
+    path: /ipfs
+fs:
+  compress:
+    default_algo: lz4
+`
+
+	report, err := cfg.ReloadWithReport(NewYamlDecoder(strings.NewReader(newConfig)))
+	require.Nil(t, err)
+	require.Equal(t, 3, report.Changes())
+	require.True(t, report.NeedsRestart())
+	require.Equal(t, []string{"fs.compress.default_algo"}, report.LiveKeys())
+	require.Equal(t, []string{"daemon.port", "data.ipfs.path"}, report.RestartKeys())
+	require.Equal(t, "3 keys changed; restart required for: daemon.port, data.ipfs.path", report.String())
+
+	// Nothing changed:
+	report, err = cfg.ReloadWithReport(NewYamlDecoder(strings.NewReader(newConfig)))
+	require.Nil(t, err)
+	require.Equal(t, 0, report.Changes())
+	require.False(t, report.NeedsRestart())
+	require.Equal(t, "0 keys changed", report.String())
+}
+
+func TestReloadWithReportSection(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	newConfig := `daemon:
+  port: 7777
+fs:
+  compress:
+    default_algo: lz4
+`
+
+	// Only the changes in the section are reported:
+	report, err := cfg.Section("daemon").ReloadWithReport(NewYamlDecoder(strings.NewReader(newConfig)))
+	require.Nil(t, err)
+	require.Equal(t, 1, report.Changes())
+	require.Empty(t, report.LiveKeys())
+	require.Equal(t, []string{"port"}, report.RestartKeys())
+	require.Equal(t, "lz4", cfg.String("fs.compress.default_algo"))
+}
+
+func TestMergeWithReport(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	other, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+	require.Nil(t, other.SetInt("daemon.port", 7777))
+	require.Nil(t, other.SetString("fs.compress.default_algo", "lz4"))
+
+	report, err := cfg.Section("daemon").MergeWithReport(other.Section("daemon"))
+	require.Nil(t, err)
+	require.Empty(t, report.Live)
+	require.Equal(t, []Change{{
+		Key:          "port",
+		Old:          int64(6667),
+		New:          int64(7777),
+		Origin:       OriginMerge,
+		NeedsRestart: true,
+	}}, report.Restart)
+
+	report, err = cfg.MergeWithReport(other)
+	require.Nil(t, err)
+	require.Equal(t, []string{"fs.compress.default_algo"}, report.LiveKeys())
+	require.Empty(t, report.RestartKeys())
+}
+
+func TestPendingRestart(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+	require.Empty(t, cfg.PendingRestart())
+
+	require.Nil(t, cfg.SetInt("daemon.port", 7777))
+	require.Nil(t, cfg.SetString("fs.compress.default_algo", "lz4"))
+	require.Equal(t, []string{"daemon.port"}, cfg.PendingRestart())
+	require.Equal(t, []string{"port"}, cfg.Section("daemon").PendingRestart())
+
+	// Changing it back means there is nothing to restart for:
+	require.Nil(t, cfg.Reload(NewYamlDecoder(strings.NewReader(testConfig))))
+	require.Empty(t, cfg.PendingRestart())
+
+	require.Nil(t, cfg.SetString("data.ipfs.path", "y"))
+	require.Equal(t, []string{"data.ipfs.path"}, cfg.PendingRestart())
+
+	cfg.MarkStarted()
+	require.Empty(t, cfg.PendingRestart())
+}
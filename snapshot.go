@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Snapshot is a read-only view of a config at the time Snapshot() was
+// called. Later changes to the config are not visible in it, so several
+// keys can be read without another goroutine changing them in between.
+//
+// Taking a snapshot is cheap, since the config never modifies its memory
+// in place. Snapshots are comparable: two snapshots of the same config are
+// equal (==) if no value was written between taking them.
+type Snapshot struct {
+	cfg   *Config
+	state *memorySnapshot
+}
+
+// Snapshot returns a read-only view of the current state of `cfg`.
+// If `cfg` is a section, the keys of the snapshot are relative to it.
+func (cfg *Config) Snapshot() Snapshot {
+	return Snapshot{
+		cfg:   cfg,
+		state: cfg.state.snapshot(),
+	}
+}
+
+// get is the worker for the higher level typed accessors
+func (snap Snapshot) get(key string) interface{} {
+	return snap.cfg.getFrom(snap.state, key)
+}
+
+// Get returns the raw value at `key` in the snapshot.
+// Do not use this method when possible, use the typeed convinience methods.
+// Note: This function might panic when they key does not exist and StrictnessPanic is used.
+// If an error happens it will return the zero value.
+func (snap Snapshot) Get(key string) interface{} {
+	return copySlice(snap.get(key))
+}
+
+// getTyped returns the value at `key` as T. Values usually have the right
+// type already; checking that first avoids boxing the result in checkZeroType().
+func getTyped[T bool | string | int64 | float64](snap Snapshot, key string) T {
+	var zero T
+	val := snap.get(key)
+	if val == nil {
+		return zero
+	}
+
+	if v, ok := val.(T); ok {
+		return v
+	}
+
+	return snap.cfg.checkZeroType(key, val, zero).(T)
+}
+
+// Bool returns the boolean value (or default) at `key` in the snapshot.
+// Note: This function might panic when they key does not exist and StrictnessPanic is used.
+// If an error happens it will return the zero value.
+func (snap Snapshot) Bool(key string) bool {
+	return getTyped[bool](snap, key)
+}
+
+// String returns the string value (or default) at `key` in the snapshot.
+// Note: This function might panic when they key does not exist and StrictnessPanic is used.
+// If an error happens it will return the zero value.
+func (snap Snapshot) String(key string) string {
+	return getTyped[string](snap, key)
+}
+
+// Int returns the int value (or default) at `key` in the snapshot.
+// Note: This function might panic when they key does not exist and StrictnessPanic is used.
+// If an error happens it will return the zero value.
+func (snap Snapshot) Int(key string) int64 {
+	return getTyped[int64](snap, key)
+}
+
+// Float returns the float value (or default) at `key` in the snapshot.
+// Note: This function might panic when they key does not exist and StrictnessPanic is used.
+// If an error happens it will return the zero value.
+func (snap Snapshot) Float(key string) float64 {
+	return getTyped[float64](snap, key)
+}
+
+// Duration returns the duration value (or default) at `key` in the snapshot.
+// Note: This function might panic when they key does not exist and StrictnessPanic is used.
+// If an error happens it will return the zero value.
+func (snap Snapshot) Duration(key string) time.Duration {
+	val := snap.get(key)
+	if val == nil {
+		return time.Duration(0)
+	}
+
+	s, ok := val.(string)
+	if !ok {
+		s = snap.cfg.checkZeroType(key, val, "").(string)
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		complain(Complaint{
+			Kind: ComplaintInvalidValue,
+			Key:  prefixKey(snap.cfg.section, key),
+			Msg:  fmt.Sprintf("invalid duration: %v; use the duration validator!", s),
+		}, snap.cfg.strictness)
+		return time.Duration(0)
+	}
+
+	return d
+}
+
+// Strings returns the string list value (or default) at `key` in the snapshot.
+// Note: This function might panic when they key does not exist and StrictnessPanic is used.
+// If an error happens it will return the zero value.
+func (snap Snapshot) Strings(key string) []string {
+	val := snap.get(key)
+	if val == nil {
+		return nil
+	}
+
+	return snap.cfg.checkZeroType(key, val, []string{}).([]string)
+}
+
+// Ints returns the int list value (or default) at `key` in the snapshot.
+// Note: This function might panic when they key does not exist and StrictnessPanic is used.
+// If an error happens it will return the zero value.
+func (snap Snapshot) Ints(key string) []int64 {
+	val := snap.get(key)
+	if val == nil {
+		return nil
+	}
+
+	return snap.cfg.checkZeroType(key, val, []int64{}).([]int64)
+}
+
+// Floats returns the float list value (or default) at `key` in the snapshot.
+// Note: This function might panic when they key does not exist and StrictnessPanic is used.
+// If an error happens it will return the zero value.
+func (snap Snapshot) Floats(key string) []float64 {
+	val := snap.get(key)
+	if val == nil {
+		return nil
+	}
+
+	return snap.cfg.checkZeroType(key, val, []float64{}).([]float64)
+}
+
+// Bools returns the boolean list value (or default) at `key` in the snapshot.
+// Note: This function might panic when they key does not exist and StrictnessPanic is used.
+// If an error happens it will return the zero value.
+func (snap Snapshot) Bools(key string) []bool {
+	val := snap.get(key)
+	if val == nil {
+		return nil
+	}
+
+	return snap.cfg.checkZeroType(key, val, []bool{}).([]bool)
+}
+
+// Durations returns the duration value (or default) at `key` in the snapshot.
+// Note: This function might panic when they key does not exist and StrictnessPanic is used.
+// If an error happens it will return the zero value.
+func (snap Snapshot) Durations(key string) []time.Duration {
+	val := snap.get(key)
+	if val == nil {
+		return nil
+	}
+
+	strings := snap.cfg.checkZeroType(key, val, []string{}).([]string)
+	durations := []time.Duration{}
+
+	for _, s := range strings {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			complain(Complaint{
+				Kind: ComplaintInvalidValue,
+				Key:  prefixKey(snap.cfg.section, key),
+				Msg:  fmt.Sprintf("invalid duration: %v; use the durations validator!", s),
+			}, snap.cfg.strictness)
+			return nil
+		}
+
+		durations = append(durations, d)
+	}
+
+	return durations
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotIsFrozen(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	snap := cfg.Snapshot()
+	require.Nil(t, cfg.SetInt("daemon.port", 7777))
+	require.Nil(t, cfg.SetString("data.ipfs.path", "y"))
+
+	require.Equal(t, int64(6667), snap.Int("daemon.port"))
+	require.Equal(t, "x", snap.String("data.ipfs.path"))
+	require.Equal(t, int64(7777), cfg.Snapshot().Int("daemon.port"))
+
+	newConfig := strings.Replace(testConfig, "port: 6667", "port: 8888", 1)
+	require.Nil(t, cfg.Reload(NewYamlDecoder(strings.NewReader(newConfig))))
+	require.Equal(t, int64(6667), snap.Int("daemon.port"))
+	require.Equal(t, int64(8888), cfg.Int("daemon.port"))
+}
+
+func TestSnapshotEqual(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	a := cfg.Snapshot()
+	b := cfg.Snapshot()
+	require.True(t, a == b)
+
+	// Setting the same value again is not a change:
+	require.Nil(t, cfg.SetInt("daemon.port", 6667))
+	require.True(t, a == cfg.Snapshot())
+
+	require.Nil(t, cfg.SetInt("daemon.port", 6668))
+	c := cfg.Snapshot()
+	require.False(t, a == c)
+	require.True(t, c == cfg.Snapshot())
+}
+
+func TestSnapshotSection(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	snap := cfg.Section("daemon").Snapshot()
+	require.Nil(t, cfg.SetInt("daemon.port", 7777))
+
+	require.Equal(t, int64(6667), snap.Int("port"))
+	require.Equal(t, int64(6667), snap.Get("port"))
+	require.Equal(t, int64(7777), cfg.Section("daemon").Snapshot().Int("port"))
+}
+
+func TestSnapshotWrongKey(t *testing.T) {
+	defer func() { require.NotNil(t, recover()) }()
+
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	// should panic.
+	cfg.Snapshot().Int("not.existing")
+}
+
+func TestSnapshotSlicesAreCopies(t *testing.T) {
+	defaults := DefaultMapping{
+		"strings": DefaultEntry{
+			Default: []string{"a", "b"},
+		},
+		"ints": DefaultEntry{
+			Default: []int64{1, 2},
+		},
+		"floats": DefaultEntry{
+			Default: []float64{1.5, 2.5},
+		},
+	}
+
+	cfg, err := Open(nil, defaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	// Modifying a returned slice must not change the defaults:
+	cfg.Ints("ints")[0] = 42
+	cfg.Floats("floats")[0] = 42
+	cfg.Get("ints").([]int64)[1] = 42
+	require.Equal(t, []int64{1, 2}, cfg.Ints("ints"))
+	require.Equal(t, []float64{1.5, 2.5}, cfg.Floats("floats"))
+
+	// ...nor the memory shared by the config and its snapshots:
+	vals := []string{"x", "y"}
+	require.Nil(t, cfg.SetStrings("strings", vals))
+	snap := cfg.Snapshot()
+
+	vals[0] = "z"
+	snap.Strings("strings")[1] = "z"
+	cfg.Strings("strings")[1] = "z"
+	require.Equal(t, []string{"x", "y"}, snap.Strings("strings"))
+	require.Equal(t, []string{"x", "y"}, cfg.Strings("strings"))
+}
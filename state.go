@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// memoryState holds the memory of a config and all of its sections.
+//
+// The memory stored in it is never modified. Writers (holding the config's
+// mutex) build a new version with setInMemory() and friends, which copy only
+// the sections on the path to the changed value, and store it. This way the
+// getters can read without taking any lock.
+type memoryState struct {
+	value atomic.Value
+}
+
+// memorySnapshot is a single version of the memory. Next to the nested
+// memory it keeps all values by their full key for quick lookups.
+type memorySnapshot struct {
+	memory map[interface{}]interface{}
+	values map[string]interface{}
+}
+
+func newMemoryState(memory map[interface{}]interface{}) *memoryState {
+	ms := &memoryState{}
+	ms.store(memory)
+	return ms
+}
+
+func (ms *memoryState) snapshot() *memorySnapshot {
+	return ms.value.Load().(*memorySnapshot)
+}
+
+func (ms *memoryState) load() map[interface{}]interface{} {
+	return ms.snapshot().memory
+}
+
+// lookup returns the value at the full `key`, if it is in memory.
+// Sections are not returned.
+func (ms *memoryState) lookup(key string) (interface{}, bool) {
+	val, ok := ms.snapshot().values[key]
+	return val, ok
+}
+
+func (ms *memoryState) store(memory map[interface{}]interface{}) {
+	ms.value.Store(&memorySnapshot{
+		memory: memory,
+		values: flattenMemory(memory),
+	})
+}
+
+// storeChanged works like store(), but `memory` may only differ from the
+// current memory in the values of `changed`, which maps full keys to their
+// new value. This saves walking all of `memory` again.
+func (ms *memoryState) storeChanged(memory map[interface{}]interface{}, changed map[string]interface{}) {
+	prev := ms.snapshot().values
+	values := make(map[string]interface{}, len(prev)+len(changed))
+	for key, val := range prev {
+		values[key] = val
+	}
+
+	for key, val := range changed {
+		values[key] = val
+	}
+
+	ms.value.Store(&memorySnapshot{
+		memory: memory,
+		values: values,
+	})
+}
+
+func (ms *memoryState) storeSnapshot(snap *memorySnapshot) {
+	ms.value.Store(snap)
+}
+
+// copySection returns a shallow copy of `section`.
+func copySection(section map[interface{}]interface{}) map[interface{}]interface{} {
+	result := make(map[interface{}]interface{}, len(section)+1)
+	for key, child := range section {
+		result[key] = child
+	}
+
+	return result
+}
+
+// copySlice returns a copy of `val` if it is a slice and `val` otherwise.
+// Slices in the memory are shared between all snapshots, so they may not be
+// handed out to the caller, who might modify them.
+func copySlice(val interface{}) interface{} {
+	src := reflect.ValueOf(val)
+	if src.Kind() != reflect.Slice || src.IsNil() {
+		return val
+	}
+
+	dst := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+	reflect.Copy(dst, src)
+	return dst.Interface()
+}
+
+// setInMemory returns a version of `root` with the value at `keys` set to
+// `val`. Missing sections are created. `root` is not modified; only the
+// sections on the path to the value are copied, the rest is shared.
+func setInMemory(root map[interface{}]interface{}, keys []string, val interface{}) (map[interface{}]interface{}, error) {
+	result := copySection(root)
+	if len(keys) == 1 {
+		result[keys[0]] = val
+		return result, nil
+	}
+
+	var section map[interface{}]interface{}
+	switch child := root[keys[0]].(type) {
+	case nil:
+		section = make(map[interface{}]interface{})
+	case map[interface{}]interface{}:
+		section = child
+	default:
+		return nil, fmt.Errorf("trying to override value with section: %v", keys)
+	}
+
+	newSection, err := setInMemory(section, keys[1:], val)
+	if err != nil {
+		return nil, err
+	}
+
+	result[keys[0]] = newSection
+	return result, nil
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetInMemoryDoesNotModify(t *testing.T) {
+	root := map[interface{}]interface{}{
+		"a": map[interface{}]interface{}{
+			"b": 1,
+		},
+		"c": map[interface{}]interface{}{
+			"d": 2,
+		},
+	}
+
+	newRoot, err := setInMemory(root, []string{"a", "b"}, 3)
+	require.Nil(t, err)
+
+	require.Equal(t, 1, root["a"].(map[interface{}]interface{})["b"])
+	require.Equal(t, 3, newRoot["a"].(map[interface{}]interface{})["b"])
+
+	// Untouched sections are shared:
+	require.Equal(t, fmt.Sprintf("%p", root["c"]), fmt.Sprintf("%p", newRoot["c"]))
+
+	newRoot, err = setInMemory(root, []string{"x", "y"}, 4)
+	require.Nil(t, err)
+	require.Equal(t, 4, newRoot["x"].(map[interface{}]interface{})["y"])
+	require.Nil(t, root["x"])
+
+	_, err = setInMemory(root, []string{"a", "b", "c"}, 5)
+	require.NotNil(t, err)
+}
+
+func TestStoreChangedMatchesFlatten(t *testing.T) {
+	cfg, err := Open(nil, testManyDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	require.Nil(t, cfg.SetString("mounts.music.path", "/music"))
+	require.Nil(t, cfg.SetBool("mounts.music.options.read_only", true))
+
+	tx := cfg.Begin()
+	require.Nil(t, tx.SetString("mounts.photos.path", "/photos"))
+	require.Nil(t, tx.SetString("mounts.default.path", "/data"))
+	require.Nil(t, tx.Commit())
+
+	snap := cfg.state.snapshot()
+	require.Equal(t, flattenMemory(snap.memory), snap.values)
+}
+
+func TestSectionSeesReload(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	daemon := cfg.Section("daemon")
+	require.Equal(t, int64(6667), daemon.Int("port"))
+
+	newConfig := strings.Replace(testConfig, "port: 6667", "port: 7777", 1)
+	require.Nil(t, cfg.Reload(NewYamlDecoder(strings.NewReader(newConfig))))
+	require.Equal(t, int64(7777), daemon.Int("port"))
+
+	require.Nil(t, cfg.Reset(""))
+	require.Equal(t, int64(6666), daemon.Int("port"))
+}
+
+func TestConcurrentGetSet(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	wg := &sync.WaitGroup{}
+	for idx := 0; idx < 8; idx++ {
+		wg.Add(2)
+		go func(idx int) {
+			defer wg.Done()
+			for jdx := 0; jdx < 100; jdx++ {
+				require.Nil(t, cfg.SetInt("daemon.port", int64(7000+idx*100+jdx)))
+			}
+		}(idx)
+
+		go func() {
+			defer wg.Done()
+			for jdx := 0; jdx < 100; jdx++ {
+				require.True(t, cfg.Int("daemon.port") > 6000)
+				require.Equal(t, "x", cfg.String("data.ipfs.path"))
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+////////////
+
+func benchmarkGet(b *testing.B, cfg *Config) {
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cfg.Int("daemon.port")
+			cfg.String("fs.compress.default_algo")
+		}
+	})
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(b, err)
+
+	benchmarkGet(b, cfg)
+}
+
+// BenchmarkGetScaling shows how read throughput scales with GOMAXPROCS.
+// Since getters do not lock, the time per op should go down as procs go up.
+func BenchmarkGetScaling(b *testing.B) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(b, err)
+
+	maxProcs := runtime.GOMAXPROCS(0)
+	defer runtime.GOMAXPROCS(maxProcs)
+
+	for procs := 1; procs <= runtime.NumCPU(); procs *= 2 {
+		b.Run(fmt.Sprintf("procs=%d", procs), func(b *testing.B) {
+			runtime.GOMAXPROCS(procs)
+			benchmarkGet(b, cfg)
+		})
+	}
+}
+
+// BenchmarkGetSection reads from a section; run it with -benchmem.
+// Like on the root config, reading must not allocate.
+func BenchmarkGetSection(b *testing.B) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(b, err)
+	require.Nil(b, cfg.SetInt("daemon.port", 7777))
+
+	daemon := cfg.Section("daemon")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		daemon.Int("port")
+	}
+
+	b.StopTimer()
+	if allocs := testing.AllocsPerRun(100, func() { daemon.Int("port") }); allocs != 0 {
+		b.Fatalf("reading a section allocates %v times per op", allocs)
+	}
+}
+
+func BenchmarkSet(b *testing.B) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(b, err)
+
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		cfg.SetInt("daemon.port", int64(7000+idx%1000))
+	}
+}
+
+// BenchmarkGetWithWriter measures reads while another goroutine keeps writing.
+func BenchmarkGetWithWriter(b *testing.B) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(b, err)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for port := int64(7000); ; port++ {
+			select {
+			case <-stop:
+				return
+			default:
+				cfg.SetInt("daemon.port", port)
+			}
+		}
+	}()
+
+	benchmarkGet(b, cfg)
+	close(stop)
+	<-done
+}
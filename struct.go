@@ -0,0 +1,576 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	e "github.com/pkg/errors"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// structFieldKey returns the key of `field` as given by the `config` tag.
+// Fields without tag, with the tag "-" and unexported fields are skipped.
+func structFieldKey(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+
+	key := field.Tag.Get("config")
+	if key == "" || key == "-" {
+		return "", false
+	}
+
+	return key, true
+}
+
+// isSectionField checks if the type of a field describes a section.
+func isSectionField(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct
+}
+
+// isManyField checks if the type of a field describes a __many__ section.
+func isManyField(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Map &&
+		typ.Key().Kind() == reflect.String &&
+		typ.Elem().Kind() == reflect.Struct
+}
+
+// assignValue sets `dst` to the config value `val`.
+// Numbers are converted to the size of `dst` if they fit.
+func assignValue(dst reflect.Value, val interface{}) error {
+	src := reflect.ValueOf(val)
+	if !src.IsValid() {
+		return fmt.Errorf("no value")
+	}
+
+	if dst.Type() == durationType {
+		s, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("not a duration string: %v", val)
+		}
+
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+
+		dst.SetInt(int64(d))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Bool:
+		if src.Kind() == reflect.Bool {
+			dst.SetBool(src.Bool())
+			return nil
+		}
+	case reflect.String:
+		if src.Kind() == reflect.String {
+			dst.SetString(src.String())
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if dst.OverflowInt(src.Int()) {
+				return fmt.Errorf("%d does not fit into %s", src.Int(), dst.Type())
+			}
+
+			dst.SetInt(src.Int())
+			return nil
+		case reflect.Float32, reflect.Float64:
+			// Like checkZeroType(), accept floats without fractional part:
+			f := src.Float()
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 || dst.OverflowInt(int64(f)) {
+				return fmt.Errorf("%v does not fit into %s", f, dst.Type())
+			}
+
+			dst.SetInt(int64(f))
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if src.Int() < 0 || dst.OverflowUint(uint64(src.Int())) {
+				return fmt.Errorf("%d does not fit into %s", src.Int(), dst.Type())
+			}
+
+			dst.SetUint(uint64(src.Int()))
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if dst.OverflowUint(src.Uint()) {
+				return fmt.Errorf("%d does not fit into %s", src.Uint(), dst.Type())
+			}
+
+			dst.SetUint(src.Uint())
+			return nil
+		case reflect.Float32, reflect.Float64:
+			f := src.Float()
+			if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 || dst.OverflowUint(uint64(f)) {
+				return fmt.Errorf("%v does not fit into %s", f, dst.Type())
+			}
+
+			dst.SetUint(uint64(f))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch src.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f = src.Float()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(src.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f = float64(src.Uint())
+		default:
+			return fmt.Errorf("can't assign %T to %s", val, dst.Type())
+		}
+
+		if dst.OverflowFloat(f) {
+			return fmt.Errorf("%v does not fit into %s", f, dst.Type())
+		}
+
+		dst.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if src.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+			for idx := 0; idx < src.Len(); idx++ {
+				if err := assignValue(slice.Index(idx), src.Index(idx).Interface()); err != nil {
+					return err
+				}
+			}
+
+			dst.Set(slice)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("can't assign %T to %s", val, dst.Type())
+}
+
+// Unmarshal fills the struct `v` points to with the values of `cfg`.
+// Each field that should be filled needs a `config` tag with the key
+// (relative to the section of `cfg`):
+//
+//	type Settings struct {
+//		Port    int64         `config:"port"`
+//		Timeout time.Duration `config:"timeout"`
+//		Sync    struct {
+//			IgnoreMoved bool `config:"ignore_moved"`
+//		} `config:"sync"`
+//		Mounts map[string]Mount `config:"mounts"`
+//	}
+//
+// Nested structs are filled from the section named by their tag. Maps from
+// string to a struct are filled from a __many__ section, with one entry for
+// every existing section. Integer and float fields may have any size, as long
+// as the value fits. Durations are parsed like Duration() does.
+//
+// Fields without a tag are left alone. Using a key that does not exist
+// returns an *InvalidKeyError (and complains), a field that can't hold the
+// value causes a *TypeMismatchError.
+func (cfg *Config) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("unmarshal needs a pointer to a struct, got %T", v)
+	}
+
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+
+	return cfg.unmarshalStruct(rv.Elem(), "")
+}
+
+// unmarshalStruct fills `rv` with the section at `prefix`,
+// which is relative to cfg.section. Call with cfg.mu locked.
+func (cfg *Config) unmarshalStruct(rv reflect.Value, prefix string) error {
+	typ := rv.Type()
+	for idx := 0; idx < typ.NumField(); idx++ {
+		key, ok := structFieldKey(typ.Field(idx))
+		if !ok {
+			continue
+		}
+
+		key = prefixKey(prefix, key)
+		field := rv.Field(idx)
+
+		switch {
+		case isSectionField(field.Type()):
+			if err := cfg.unmarshalStruct(field, key); err != nil {
+				return err
+			}
+		case isManyField(field.Type()):
+			if err := cfg.unmarshalMany(field, key); err != nil {
+				return err
+			}
+		default:
+			if err := cfg.unmarshalValue(field, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// unmarshalValue sets `field` to the value at `key`. Call with cfg.mu locked.
+func (cfg *Config) unmarshalValue(field reflect.Value, key string) error {
+	fullKey := prefixKey(cfg.section, key)
+	if cfg.index.entry(fullKey) == nil {
+		return cfg.invalidKey(fullKey)
+	}
+
+	val := cfg.get(key)
+	if err := assignValue(field, val); err != nil {
+		return &TypeMismatchError{
+			Key:  fullKey,
+			Want: field.Type().String(),
+			Got:  getTypeOf(val),
+		}
+	}
+
+	return nil
+}
+
+// manySectionNames returns the names of all sections below the __many__
+// section at the full `key` and the defaults of one of them.
+// Call with cfg.mu locked.
+func (cfg *Config) manySectionNames(key string) ([]string, DefaultMapping, error) {
+	defaults := cfg.index.section(key)
+	if defaults == nil {
+		return nil, nil, cfg.invalidKey(key)
+	}
+
+	manyDefaults, ok := defaults[manyMarker].(DefaultMapping)
+	if !ok {
+		return nil, nil, fmt.Errorf("section %s has no __many__ section", key)
+	}
+
+	names := []string{}
+	parent, base := cfg.splitKey(key, true)
+	if parent == nil {
+		return names, manyDefaults, nil
+	}
+
+	section, _ := parent[base].(map[interface{}]interface{})
+	for nameVal, child := range section {
+		name, ok := nameVal.(string)
+		if !ok {
+			continue
+		}
+
+		if _, isSection := child.(map[interface{}]interface{}); !isSection {
+			continue
+		}
+
+		if _, isExplicit := defaults[name]; !isExplicit {
+			names = append(names, name)
+		}
+	}
+
+	return names, manyDefaults, nil
+}
+
+// unmarshalMany fills the map `field` with the sections below the __many__
+// section at `key`. Call with cfg.mu locked.
+func (cfg *Config) unmarshalMany(field reflect.Value, key string) error {
+	names, _, err := cfg.manySectionNames(prefixKey(cfg.section, key))
+	if err != nil {
+		return err
+	}
+
+	result := reflect.MakeMapWithSize(field.Type(), len(names))
+	for _, name := range names {
+		elem := reflect.New(field.Type().Elem()).Elem()
+		if err := cfg.unmarshalStruct(elem, prefixKey(key, name)); err != nil {
+			return err
+		}
+
+		result.SetMapIndex(reflect.ValueOf(name).Convert(field.Type().Key()), elem)
+	}
+
+	field.Set(result)
+	return nil
+}
+
+////////////
+
+// configZero returns the zero value of the config type
+// that is used to store fields of type `typ`.
+func configZero(typ reflect.Type) (interface{}, error) {
+	if typ == durationType {
+		return "0s", nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return false, nil
+	case reflect.String:
+		return "", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(0), nil
+	case reflect.Float32, reflect.Float64:
+		return float64(0), nil
+	case reflect.Slice:
+		elem, err := configZero(typ.Elem())
+		if err != nil {
+			return nil, err
+		}
+
+		switch elem.(type) {
+		case bool:
+			return []bool{}, nil
+		case string:
+			return []string{}, nil
+		case int64:
+			return []int64{}, nil
+		case float64:
+			return []float64{}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported type: %s", typ)
+}
+
+// intBounds returns the range of integer types smaller than int64.
+func intBounds(typ reflect.Type) (min, max int64, ok bool) {
+	switch typ.Kind() {
+	case reflect.Int8:
+		return math.MinInt8, math.MaxInt8, true
+	case reflect.Int16:
+		return math.MinInt16, math.MaxInt16, true
+	case reflect.Int32:
+		return math.MinInt32, math.MaxInt32, true
+	case reflect.Uint8:
+		return 0, math.MaxUint8, true
+	case reflect.Uint16:
+		return 0, math.MaxUint16, true
+	case reflect.Uint32:
+		return 0, math.MaxUint32, true
+	case reflect.Uint, reflect.Uint64:
+		return 0, math.MaxInt64, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// chainValidators returns a validator that calls `first` and then `second`,
+// if `first` succeeded. Either of them might be nil.
+func chainValidators(first, second func(val interface{}) error) func(val interface{}) error {
+	if first == nil {
+		return second
+	}
+
+	if second == nil {
+		return first
+	}
+
+	return func(val interface{}) error {
+		if err := first(val); err != nil {
+			return err
+		}
+
+		return second(val)
+	}
+}
+
+// parseValidateTag builds the validator described by the `validate` tag
+// for a field of type `typ`. It returns nil if there is nothing to validate.
+func parseValidateTag(tag string, typ reflect.Type) (func(val interface{}) error, error) {
+	elemTyp := typ
+	isList := typ.Kind() == reflect.Slice
+	if isList {
+		elemTyp = typ.Elem()
+	}
+
+	var validator func(val interface{}) error
+
+	if tag != "" {
+		split := strings.SplitN(tag, "=", 2)
+		name, arg := split[0], ""
+		if len(split) > 1 {
+			arg = split[1]
+		}
+
+		switch name {
+		case "enum":
+			validator = EnumValidator(strings.Split(arg, "|")...)
+		case "range":
+			bounds := strings.SplitN(arg, ":", 2)
+			if len(bounds) != 2 {
+				return nil, fmt.Errorf("range needs min:max, got %q", arg)
+			}
+
+			zero, err := configZero(elemTyp)
+			if err != nil {
+				return nil, err
+			}
+
+			switch zero.(type) {
+			case int64:
+				min, errMin := strconv.ParseInt(bounds[0], 10, 64)
+				max, errMax := strconv.ParseInt(bounds[1], 10, 64)
+				if errMin != nil || errMax != nil {
+					return nil, fmt.Errorf("bad int range: %q", arg)
+				}
+
+				validator = IntRangeValidator(min, max)
+			case float64:
+				min, errMin := strconv.ParseFloat(bounds[0], 64)
+				max, errMax := strconv.ParseFloat(bounds[1], 64)
+				if errMin != nil || errMax != nil {
+					return nil, fmt.Errorf("bad float range: %q", arg)
+				}
+
+				validator = FloatRangeValidator(min, max)
+			default:
+				return nil, fmt.Errorf("range is only supported for numbers")
+			}
+		case "duration":
+			// For strings holding a duration.
+			validator = DurationValidator()
+		default:
+			return nil, fmt.Errorf("unknown validator: %q", name)
+		}
+	}
+
+	// Make sure the value fits into the field before checking the tag:
+	if elemTyp == durationType {
+		validator = chainValidators(DurationValidator(), validator)
+	} else if min, max, ok := intBounds(elemTyp); ok {
+		validator = chainValidators(IntRangeValidator(min, max), validator)
+	}
+
+	if validator != nil && isList {
+		validator = ListValidator(validator)
+	}
+
+	return validator, nil
+}
+
+// DefaultsFromStruct derives a DefaultMapping from the struct `v`, which may
+// also be a pointer to it. The same struct can later be passed to
+// Unmarshal(). Fields are described by these tags:
+//
+//	config:   The key of the field. Fields without it are skipped.
+//	default:  The default value. Lists are separated by " ;; " like in Cast().
+//	          Without it, the zero value is used.
+//	doc:      The documentation of the key.
+//	restart:  "true" if the key needs a restart.
+//	validate: One of "enum=a|b|c", "range=min:max" or "duration".
+//
+// For example:
+//
+//	type Settings struct {
+//		Port uint16 `config:"port" default:"6666" restart:"true" doc:"Port to listen on"`
+//		Algo string `config:"algo" default:"snappy" validate:"enum=snappy|lz4|none"`
+//	}
+//
+// Nested structs become sections and maps from string to a struct become
+// __many__ sections. Durations are stored as strings and validated. Integer
+// fields smaller than int64 get a range validator, so the value always fits.
+func DefaultsFromStruct(v interface{}) (DefaultMapping, error) {
+	typ := reflect.TypeOf(v)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("need a struct, got %T", v)
+	}
+
+	return defaultsFromStruct(typ)
+}
+
+func defaultsFromStruct(typ reflect.Type) (DefaultMapping, error) {
+	defaults := DefaultMapping{}
+	for idx := 0; idx < typ.NumField(); idx++ {
+		field := typ.Field(idx)
+		key, ok := structFieldKey(field)
+		if !ok {
+			continue
+		}
+
+		if strings.Contains(key, ".") || key == manyMarker || key == validateMarker {
+			return nil, fmt.Errorf("field %s: invalid key: %q", field.Name, key)
+		}
+
+		if _, exists := defaults[key]; exists {
+			return nil, fmt.Errorf("field %s: duplicate key: %q", field.Name, key)
+		}
+
+		switch {
+		case isSectionField(field.Type):
+			section, err := defaultsFromStruct(field.Type)
+			if err != nil {
+				return nil, e.Wrapf(err, "section %s", key)
+			}
+
+			defaults[key] = section
+		case isManyField(field.Type):
+			section, err := defaultsFromStruct(field.Type.Elem())
+			if err != nil {
+				return nil, e.Wrapf(err, "section %s", key)
+			}
+
+			defaults[key] = DefaultMapping{manyMarker: section}
+		default:
+			entry, err := defaultEntryFromField(field)
+			if err != nil {
+				return nil, e.Wrapf(err, "field %s", field.Name)
+			}
+
+			defaults[key] = entry
+		}
+	}
+
+	return defaults, nil
+}
+
+func defaultEntryFromField(field reflect.StructField) (DefaultEntry, error) {
+	def, err := configZero(field.Type)
+	if err != nil {
+		return DefaultEntry{}, err
+	}
+
+	if tag, ok := field.Tag.Lookup("default"); ok && tag != "" {
+		def, err = castValue(def, tag)
+		if err != nil {
+			return DefaultEntry{}, e.Wrapf(err, "default")
+		}
+	}
+
+	validator, err := parseValidateTag(field.Tag.Get("validate"), field.Type)
+	if err != nil {
+		return DefaultEntry{}, err
+	}
+
+	// Catch bad defaults early:
+	if validator != nil {
+		if err := validator(def); err != nil {
+			return DefaultEntry{}, e.Wrapf(err, "default")
+		}
+	}
+
+	needsRestart := false
+	if tag := field.Tag.Get("restart"); tag != "" {
+		needsRestart, err = strconv.ParseBool(tag)
+		if err != nil {
+			return DefaultEntry{}, e.Wrapf(err, "restart")
+		}
+	}
+
+	return DefaultEntry{
+		Default:      def,
+		NeedsRestart: needsRestart,
+		Docs:         field.Tag.Get("doc"),
+		Validator:    validator,
+	}, nil
+}
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testStructDefaults = DefaultMapping{
+	"daemon": DefaultMapping{
+		"port": DefaultEntry{
+			Default: 6666,
+		},
+		"timeout": DefaultEntry{
+			Default:   "5s",
+			Validator: DurationValidator(),
+		},
+		"ratio": DefaultEntry{
+			Default: 0.5,
+		},
+		"verbose": DefaultEntry{
+			Default: false,
+		},
+		"hosts": DefaultEntry{
+			Default: []string{"localhost"},
+		},
+		"backoff": DefaultEntry{
+			Default:   []string{"1s", "2s"},
+			Validator: ListValidator(DurationValidator()),
+		},
+	},
+	"mounts": DefaultMapping{
+		"__many__": DefaultMapping{
+			"path": DefaultEntry{
+				Default: "",
+			},
+			"read_only": DefaultEntry{
+				Default: false,
+			},
+		},
+	},
+}
+
+type testDaemonSettings struct {
+	Port    uint16          `config:"port"`
+	Timeout time.Duration   `config:"timeout"`
+	Ratio   float32         `config:"ratio"`
+	Verbose bool            `config:"verbose"`
+	Hosts   []string        `config:"hosts"`
+	Backoff []time.Duration `config:"backoff"`
+
+	Untagged string
+}
+
+type testMountSettings struct {
+	Path     string `config:"path"`
+	ReadOnly bool   `config:"read_only"`
+}
+
+type testSettings struct {
+	Daemon testDaemonSettings           `config:"daemon"`
+	Mounts map[string]testMountSettings `config:"mounts"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	data := `daemon:
+  port: 8080
+  timeout: 1m
+  hosts: [a, b]
+mounts:
+  music:
+    path: /music
+    read_only: true
+  photos:
+    path: /photos
+`
+
+	cfg, err := openFromString(data, testStructDefaults)
+	require.Nil(t, err)
+
+	settings := testSettings{}
+	settings.Daemon.Untagged = "untouched"
+	require.Nil(t, cfg.Unmarshal(&settings))
+
+	require.Equal(t, testSettings{
+		Daemon: testDaemonSettings{
+			Port:     8080,
+			Timeout:  time.Minute,
+			Ratio:    0.5,
+			Hosts:    []string{"a", "b"},
+			Backoff:  []time.Duration{time.Second, 2 * time.Second},
+			Untagged: "untouched",
+		},
+		Mounts: map[string]testMountSettings{
+			"music":  {Path: "/music", ReadOnly: true},
+			"photos": {Path: "/photos"},
+		},
+	}, settings)
+
+	// Sections work the same way:
+	daemon := testDaemonSettings{}
+	require.Nil(t, cfg.Section("daemon").Unmarshal(&daemon))
+	require.Equal(t, settings.Daemon.Port, daemon.Port)
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	cfg, err := Open(nil, testStructDefaults, StrictnessIgnore)
+	require.Nil(t, err)
+
+	require.NotNil(t, cfg.Unmarshal(testSettings{}))
+
+	var tme *TypeMismatchError
+	wrongType := struct {
+		Port string `config:"daemon.port"`
+	}{}
+	require.True(t, errors.As(cfg.Unmarshal(&wrongType), &tme))
+	require.Equal(t, "daemon.port", tme.Key)
+
+	require.Nil(t, cfg.SetInt("daemon.port", 100000))
+	tooSmall := struct {
+		Port uint16 `config:"daemon.port"`
+	}{}
+	require.True(t, errors.As(cfg.Unmarshal(&tooSmall), &tme))
+
+	var ike *InvalidKeyError
+	notExisting := struct {
+		Value string `config:"not.existing"`
+	}{}
+	require.True(t, errors.As(cfg.Unmarshal(&notExisting), &ike))
+}
+
+func TestUnmarshalNumberConversion(t *testing.T) {
+	data := `daemon:
+  port: 8080.0
+  ratio: 1
+`
+
+	cfg, err := openFromString(data, testStructDefaults)
+	require.Nil(t, err)
+
+	daemon := testDaemonSettings{}
+	require.Nil(t, cfg.Section("daemon").Unmarshal(&daemon))
+	require.Equal(t, uint16(8080), daemon.Port)
+	require.Equal(t, float32(1), daemon.Ratio)
+
+	var i8 int8
+	require.Nil(t, assignValue(reflect.ValueOf(&i8).Elem(), 12.0))
+	require.Equal(t, int8(12), i8)
+	require.NotNil(t, assignValue(reflect.ValueOf(&i8).Elem(), 12.5))
+	require.NotNil(t, assignValue(reflect.ValueOf(&i8).Elem(), 300.0))
+	require.NotNil(t, assignValue(reflect.ValueOf(&i8).Elem(), 1e300))
+
+	var u8 uint8
+	require.Nil(t, assignValue(reflect.ValueOf(&u8).Elem(), 255.0))
+	require.Equal(t, uint8(255), u8)
+	require.NotNil(t, assignValue(reflect.ValueOf(&u8).Elem(), -1.0))
+
+	var f32 float32
+	require.Nil(t, assignValue(reflect.ValueOf(&f32).Elem(), int64(3)))
+	require.Equal(t, float32(3), f32)
+	require.Nil(t, assignValue(reflect.ValueOf(&f32).Elem(), uint64(4)))
+	require.Equal(t, float32(4), f32)
+	require.NotNil(t, assignValue(reflect.ValueOf(&f32).Elem(), 1e300))
+	require.NotNil(t, assignValue(reflect.ValueOf(&f32).Elem(), "1"))
+}
+
+type testSchemaMount struct {
+	Path     string `config:"path" doc:"Where to mount"`
+	ReadOnly bool   `config:"read_only" default:"true"`
+}
+
+type testSchema struct {
+	Daemon struct {
+		Port    uint16        `config:"port" default:"6666" restart:"true" doc:"Port of the daemon"`
+		Timeout time.Duration `config:"timeout" default:"5s"`
+		Algo    string        `config:"algo" default:"snappy" validate:"enum=snappy|lz4|none"`
+		Ratio   float64       `config:"ratio" default:"0.5" validate:"range=0:1"`
+		Hosts   []string      `config:"hosts" default:"a ;; b"`
+		Levels  []int64       `config:"levels" validate:"range=1:9"`
+	} `config:"daemon"`
+	Mounts map[string]testSchemaMount `config:"mounts"`
+
+	Ignored int
+}
+
+func TestDefaultsFromStruct(t *testing.T) {
+	defaults, err := DefaultsFromStruct(&testSchema{})
+	require.Nil(t, err)
+
+	cfg, err := Open(nil, defaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	require.Equal(t, int64(6666), cfg.Int("daemon.port"))
+	require.Equal(t, 5*time.Second, cfg.Duration("daemon.timeout"))
+	require.Equal(t, "snappy", cfg.String("daemon.algo"))
+	require.Equal(t, 0.5, cfg.Float("daemon.ratio"))
+	require.Equal(t, []string{"a", "b"}, cfg.Strings("daemon.hosts"))
+	require.Equal(t, []int64{}, cfg.Ints("daemon.levels"))
+	require.True(t, cfg.Bool("mounts.music.read_only"))
+
+	entry := cfg.GetDefault("daemon.port")
+	require.True(t, entry.NeedsRestart)
+	require.Equal(t, "Port of the daemon", entry.Docs)
+	require.Equal(t, "Where to mount", cfg.GetDefault("mounts.x.path").Docs)
+
+	// Validators derived from the tags:
+	require.NotNil(t, cfg.SetInt("daemon.port", 70000))
+	require.NotNil(t, cfg.SetString("daemon.timeout", "soon"))
+	require.NotNil(t, cfg.SetString("daemon.algo", "gzip"))
+	require.NotNil(t, cfg.SetFloat("daemon.ratio", 1.5))
+	require.NotNil(t, cfg.SetInts("daemon.levels", []int64{5, 10}))
+	require.Nil(t, cfg.SetInts("daemon.levels", []int64{5, 9}))
+
+	// The same struct can be filled from the config:
+	require.Nil(t, cfg.SetString("mounts.music.path", "/music"))
+	settings := testSchema{}
+	require.Nil(t, cfg.Unmarshal(&settings))
+	require.Equal(t, uint16(6666), settings.Daemon.Port)
+	require.Equal(t, "/music", settings.Mounts["music"].Path)
+}
+
+func TestDefaultsFromStructChainedValidators(t *testing.T) {
+	defaults, err := DefaultsFromStruct(&struct {
+		Level   int8          `config:"level" validate:"range=-10:200"`
+		Timeout time.Duration `config:"timeout" default:"1s" validate:"enum=1s|2s"`
+	}{})
+	require.Nil(t, err)
+
+	cfg, err := Open(nil, defaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	// Both the tag and the size of the field are checked:
+	require.Nil(t, cfg.SetInt("level", 100))
+	require.NotNil(t, cfg.SetInt("level", -20))
+	require.NotNil(t, cfg.SetInt("level", 150))
+
+	require.Nil(t, cfg.SetString("timeout", "2s"))
+	require.NotNil(t, cfg.SetString("timeout", "3s"))
+	require.NotNil(t, cfg.SetString("timeout", "soon"))
+}
+
+func TestDefaultsFromStructErrors(t *testing.T) {
+	tcs := []interface{}{
+		42,
+		struct {
+			Port int `config:"port" default:"x"`
+		}{},
+		struct {
+			Port uint8 `config:"port" default:"300"`
+		}{},
+		struct {
+			Algo string `config:"algo" default:"x" validate:"enum=a|b"`
+		}{},
+		struct {
+			Algo string `config:"algo" validate:"unknown"`
+		}{},
+		struct {
+			Ch chan int `config:"ch"`
+		}{},
+		struct {
+			A int `config:"a.b"`
+		}{},
+	}
+
+	for _, tc := range tcs {
+		_, err := DefaultsFromStruct(tc)
+		require.NotNil(t, err, "%#v", tc)
+	}
+}
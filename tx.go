@@ -0,0 +1,194 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTxDone is returned when using a transaction that was
+// already committed or rolled back.
+var ErrTxDone = errors.New("transaction was already committed or rolled back")
+
+// Tx is a set of changes that are applied together. Use Config.Begin() to
+// create one. Values set on a transaction are not visible in the config
+// until Commit() is called.
+//
+// A Tx is not safe to use from several go routines at the same time.
+type Tx struct {
+	cfg  *Config
+	done bool
+
+	// keys holds the staged keys in the order they were first set:
+	keys   []string
+	staged map[string]interface{}
+}
+
+// Begin starts a new transaction on `cfg`. Keys are relative to the
+// section of `cfg`, just like with Set().
+func (cfg *Config) Begin() *Tx {
+	return &Tx{
+		cfg:    cfg,
+		staged: make(map[string]interface{}),
+	}
+}
+
+func (tx *Tx) stage(key string, val interface{}) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	if _, ok := tx.staged[key]; !ok {
+		tx.keys = append(tx.keys, key)
+	}
+
+	tx.staged[key] = copySlice(val)
+	return nil
+}
+
+// Commit validates all staged values and applies them at once. If any of
+// the values is invalid, nothing is applied and the error is returned.
+// Change events are only fired after all values were applied, so callbacks
+// never see a partially applied transaction.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.done = true
+
+	cfg := tx.cfg
+	cfg.mu.Lock()
+
+	events := []pendingEvent{}
+	defer func() {
+		// Call the callbacks without the lock:
+		fireEvents(events)
+	}()
+
+	// NOTE: the unlock is called before the other defer!
+	defer cfg.mu.Unlock()
+
+	staged := make(map[string]interface{})
+	for _, key := range tx.keys {
+		fullKey := prefixKey(cfg.section, key)
+		if err := cfg.checkSet(fullKey, tx.staged[key]); err != nil {
+			return err
+		}
+
+		staged[fullKey] = tx.staged[key]
+	}
+
+	if err := cfg.checkConfigValidators(staged); err != nil {
+		return err
+	}
+
+	// Build the new memory first, so that nothing is applied on errors:
+	memory := cfg.state.load()
+	modified := false
+	changes := []Change{}
+	for _, key := range tx.keys {
+		newMemory, change, err := cfg.stageSet(memory, prefixKey(cfg.section, key), tx.staged[key], OriginSet)
+		if err != nil {
+			return err
+		}
+
+		if newMemory != nil {
+			memory = newMemory
+			modified = true
+		}
+
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	if modified {
+		cfg.state.storeChanged(memory, staged)
+	}
+
+	for _, key := range tx.keys {
+		cfg.markSet(prefixKey(cfg.section, key))
+	}
+
+	for _, change := range changes {
+		events = append(events, cfg.gatherCallbacks(change)...)
+	}
+
+	return nil
+}
+
+// Rollback discards all staged values.
+// Calling it after Commit() has no effect besides returning ErrTxDone.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.done = true
+	tx.keys = nil
+	tx.staged = nil
+	return nil
+}
+
+////////////
+
+// SetBool stages `val` at `key`.
+func (tx *Tx) SetBool(key string, val bool) error {
+	return tx.stage(key, val)
+}
+
+// SetString stages `val` at `key`.
+func (tx *Tx) SetString(key string, val string) error {
+	return tx.stage(key, val)
+}
+
+// SetInt stages `val` at `key`.
+func (tx *Tx) SetInt(key string, val int64) error {
+	return tx.stage(key, val)
+}
+
+// SetFloat stages `val` at `key`.
+func (tx *Tx) SetFloat(key string, val float64) error {
+	return tx.stage(key, val)
+}
+
+// SetDuration stages `val` at `key`.
+func (tx *Tx) SetDuration(key string, val time.Duration) error {
+	return tx.stage(key, val.String())
+}
+
+// SetBools stages `val` at `key`.
+func (tx *Tx) SetBools(key string, val []bool) error {
+	return tx.stage(key, val)
+}
+
+// SetStrings stages `val` at `key`.
+func (tx *Tx) SetStrings(key string, val []string) error {
+	return tx.stage(key, val)
+}
+
+// SetInts stages `val` at `key`.
+func (tx *Tx) SetInts(key string, val []int64) error {
+	return tx.stage(key, val)
+}
+
+// SetFloats stages `val` at `key`.
+func (tx *Tx) SetFloats(key string, val []float64) error {
+	return tx.stage(key, val)
+}
+
+// SetDurations stages `val` at `key`.
+func (tx *Tx) SetDurations(key string, val []time.Duration) error {
+	strings := []string{}
+	for _, d := range val {
+		strings = append(strings, d.String())
+	}
+
+	return tx.stage(key, strings)
+}
+
+// Set stages `val` at `key`.
+// Like Config.Set(), prefer the typed setters if possible.
+func (tx *Tx) Set(key string, val interface{}) error {
+	return tx.stage(key, val)
+}
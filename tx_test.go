@@ -0,0 +1,103 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxCommit(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	seen := [][]string{}
+	cfg.AddEvent("", func(key string) {
+		// Both values have to be visible to every callback:
+		seen = append(seen, []string{
+			cfg.String("data.ipfs.path"),
+			cfg.String("repo.current_user"),
+		})
+	})
+
+	tx := cfg.Begin()
+	require.Nil(t, tx.SetString("data.ipfs.path", "y"))
+	require.Nil(t, tx.SetString("repo.current_user", "alice"))
+
+	// Nothing is visible before the commit:
+	require.Equal(t, "x", cfg.String("data.ipfs.path"))
+	require.Len(t, seen, 0)
+
+	require.Nil(t, tx.Commit())
+	require.Equal(t, "y", cfg.String("data.ipfs.path"))
+	require.Equal(t, "alice", cfg.String("repo.current_user"))
+	require.Equal(t, [][]string{{"y", "alice"}, {"y", "alice"}}, seen)
+
+	require.Equal(t, ErrTxDone, tx.Commit())
+	require.Equal(t, ErrTxDone, tx.SetString("data.ipfs.path", "z"))
+}
+
+func TestTxCommitInvalid(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	callCount := 0
+	cfg.AddEvent("", func(key string) {
+		callCount++
+	})
+
+	tx := cfg.Begin()
+	require.Nil(t, tx.SetInt("daemon.port", 42))
+	require.Nil(t, tx.SetString("fs.compress.default_algo", "gzip"))
+	require.NotNil(t, tx.Commit())
+
+	// The valid value should not have been applied either:
+	require.Equal(t, int64(6667), cfg.Int("daemon.port"))
+	require.Equal(t, "snappy", cfg.String("fs.compress.default_algo"))
+	require.Equal(t, 0, callCount)
+}
+
+func TestTxCommitSecondKeyInvalid(t *testing.T) {
+	cfg, err := Open(nil, testConfigValidatorDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	callCount := 0
+	cfg.AddEvent("", func(key string) {
+		callCount++
+	})
+
+	// The first key is fine on its own, the second breaks a section validator:
+	tx := cfg.Begin()
+	require.Nil(t, tx.SetString("mounts.music.path", "/music"))
+	require.Nil(t, tx.SetInt("pool.min_conns", 20))
+	require.NotNil(t, tx.Commit())
+
+	require.Equal(t, "", cfg.String("mounts.music.path"))
+	require.Equal(t, int64(1), cfg.Int("pool.min_conns"))
+	require.True(t, cfg.IsDefault("pool.min_conns"))
+	require.NotContains(t, cfg.Keys(), "mounts.music.path")
+	require.Equal(t, 0, callCount)
+}
+
+func TestTxRollback(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	tx := cfg.Begin()
+	require.Nil(t, tx.SetInt("daemon.port", 42))
+	require.Nil(t, tx.Rollback())
+	require.Equal(t, ErrTxDone, tx.Commit())
+	require.Equal(t, int64(6667), cfg.Int("daemon.port"))
+}
+
+func TestTxSection(t *testing.T) {
+	cfg, err := openFromString(testConfig, TestDefaults)
+	require.Nil(t, err)
+
+	tx := cfg.Section("fs").Begin()
+	require.Nil(t, tx.SetBool("sync.ignore_moved", true))
+	require.Nil(t, tx.SetBool("sync.ignore_removed", true))
+	require.Nil(t, tx.Commit())
+
+	require.True(t, cfg.Bool("fs.sync.ignore_moved"))
+	require.True(t, cfg.Bool("fs.sync.ignore_removed"))
+}
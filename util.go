@@ -18,13 +18,22 @@ func FromYamlFile(path string, defaults DefaultMapping, strictness Strictness) (
 }
 
 // ToYamlFile saves `cfg` as YAML at a file located at `path`.
+// If there is already a file at `path`, its comments and
+// the order of its keys are preserved.
 func ToYamlFile(path string, cfg *Config) error {
+	doc := NewYamlDocument()
+	if fd, err := os.Open(path); err == nil {
+		// If the old file is broken, we just overwrite it.
+		_, _, _ = doc.Decoder(fd).Decode()
+		fd.Close()
+	}
+
 	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
 
-	if err := cfg.Save(NewYamlEncoder(fd)); err != nil {
+	if err := cfg.Save(doc.Encoder(fd)); err != nil {
 		return err
 	}
 
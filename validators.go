@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	e "github.com/pkg/errors"
@@ -104,3 +107,177 @@ func ListValidator(fn func(val interface{}) error) func(val interface{}) error {
 		return nil
 	}
 }
+
+////////////
+
+// ConfigValidator checks constraints that span several keys, like
+// "min_conns may not be bigger than max_conns". It can be placed in a
+// DefaultMapping under the special key "__validate__":
+//
+//	"pool": DefaultMapping{
+//		"__validate__": ConfigValidator(func(cfg *Config) error {
+//			if cfg.Int("min_conns") > cfg.Int("max_conns") {
+//				return fmt.Errorf("min_conns > max_conns")
+//			}
+//
+//			return nil
+//		}),
+//		...
+//	}
+//
+// The validator gets a read-only view of the section it was placed in,
+// already containing the new values. It is called by Open(), Reload(),
+// Merge(), Tx.Commit() and every Set(). If it returns an error, the
+// operation fails and the config stays untouched. Inside a __many__
+// section, it is called once for every existing section.
+//
+// The validator may not use the config it belongs to, only the one passed.
+type ConfigValidator func(cfg *Config) error
+
+// asConfigValidator also accepts plain funcs that were not converted.
+func asConfigValidator(val interface{}) ConfigValidator {
+	switch fn := val.(type) {
+	case ConfigValidator:
+		return fn
+	case func(cfg *Config) error:
+		return fn
+	default:
+		return nil
+	}
+}
+
+// hasConfigValidators checks if any section in `defaults` has a ConfigValidator.
+func hasConfigValidators(defaults DefaultMapping) bool {
+	for key, child := range defaults {
+		if key == validateMarker && asConfigValidator(child) != nil {
+			return true
+		}
+
+		if section, ok := child.(DefaultMapping); ok && hasConfigValidators(section) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runConfigValidators calls all ConfigValidators in `defaults` on a
+// temporary config made of `memory`, which must have passed validation.
+func runConfigValidators(
+	memory map[interface{}]interface{},
+	index *keyIndex,
+	defaultKeys map[string]struct{},
+	strictness Strictness,
+) error {
+	defaults := index.section("")
+	if !hasConfigValidators(defaults) {
+		return nil
+	}
+
+	candidate := &Config{
+		mu:              &sync.Mutex{},
+		defaults:        defaults,
+		index:           index,
+		state:           newMemoryState(memory),
+		callbackCount:   new(int),
+		changeCallbacks: make(map[string]map[int]keyChangedEvent),
+		defaultKeys:     defaultKeys,
+		strictness:      strictness,
+		overrides:       make(map[string]overrideEntry),
+	}
+
+	return candidate.runConfigValidators(defaults, memory, "")
+}
+
+func (cfg *Config) runConfigValidators(defaults DefaultMapping, memory map[interface{}]interface{}, prefix string) error {
+	if validator := asConfigValidator(defaults[validateMarker]); validator != nil {
+		sectionCfg := cfg
+		if prefix != "" {
+			sectionCfg = cfg.Section(prefix)
+		}
+
+		if err := validator(sectionCfg); err != nil {
+			if prefix == "" {
+				return err
+			}
+
+			return e.Wrapf(err, "section %s", prefix)
+		}
+	}
+
+	// Go over the sections sorted, so errors are always reported the same way:
+	sectionKeys := []string{}
+	for keyVal, child := range defaults {
+		if _, ok := child.(DefaultMapping); !ok {
+			continue
+		}
+
+		if key, ok := keyVal.(string); ok && key != manyMarker {
+			sectionKeys = append(sectionKeys, key)
+		}
+	}
+
+	if _, ok := defaults[manyMarker].(DefaultMapping); ok {
+		for keyVal, child := range memory {
+			key, ok := keyVal.(string)
+			if !ok {
+				continue
+			}
+
+			if _, isSection := child.(map[interface{}]interface{}); !isSection {
+				continue
+			}
+
+			if _, isDefault := defaults[key]; !isDefault {
+				sectionKeys = append(sectionKeys, key)
+			}
+		}
+	}
+
+	sort.Strings(sectionKeys)
+
+	for _, key := range sectionKeys {
+		child, ok := defaults[key].(DefaultMapping)
+		if !ok {
+			child = defaults[manyMarker].(DefaultMapping)
+		}
+
+		section, ok := memory[key].(map[interface{}]interface{})
+		if !ok {
+			section = make(map[interface{}]interface{})
+		}
+
+		if err := cfg.runConfigValidators(child, section, prefixKey(prefix, key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkConfigValidators checks if the config would still pass all
+// ConfigValidators after setting the full keys in `changes` to their value.
+// Nothing is modified. Call with cfg.mu locked.
+func (cfg *Config) checkConfigValidators(changes map[string]interface{}) error {
+	if !hasConfigValidators(cfg.defaults) {
+		return nil
+	}
+
+	memory := cfg.state.load()
+	defaultKeys := make(map[string]struct{}, len(cfg.defaultKeys))
+	for key := range cfg.defaultKeys {
+		defaultKeys[key] = struct{}{}
+	}
+
+	for key, val := range changes {
+		var err error
+		memory, err = setInMemory(memory, strings.Split(key, "."), val)
+		if err != nil {
+			return err
+		}
+
+		delete(defaultKeys, key)
+	}
+
+	return runConfigValidators(memory, cfg.index, defaultKeys, cfg.strictness)
+}
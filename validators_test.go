@@ -1,6 +1,8 @@
 package config
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -60,3 +62,121 @@ func TestDurationValidator(t *testing.T) {
 	require.Nil(t, vdt("5m"))
 	require.Nil(t, vdt("5m20s"))
 }
+
+var testConfigValidatorDefaults = DefaultMapping{
+	"pool": DefaultMapping{
+		"__validate__": ConfigValidator(func(cfg *Config) error {
+			if cfg.Int("min_conns") > cfg.Int("max_conns") {
+				return fmt.Errorf("min_conns may not be bigger than max_conns")
+			}
+
+			return nil
+		}),
+		"min_conns": DefaultEntry{
+			Default: 1,
+		},
+		"max_conns": DefaultEntry{
+			Default: 10,
+		},
+	},
+	"tls": DefaultMapping{
+		"enabled": DefaultEntry{
+			Default: false,
+		},
+		"key": DefaultEntry{
+			Default: "",
+		},
+	},
+	"mounts": DefaultMapping{
+		"__many__": DefaultMapping{
+			"__validate__": func(cfg *Config) error {
+				if cfg.String("path") == "" {
+					return fmt.Errorf("path is required")
+				}
+
+				return nil
+			},
+			"path": DefaultEntry{
+				Default: "",
+			},
+		},
+	},
+	"__validate__": ConfigValidator(func(cfg *Config) error {
+		if cfg.Bool("tls.enabled") && cfg.String("tls.key") == "" {
+			return fmt.Errorf("tls.key is required when tls.enabled is set")
+		}
+
+		return nil
+	}),
+}
+
+func TestConfigValidatorOpen(t *testing.T) {
+	_, err := openFromString("pool:\n  min_conns: 20\n", testConfigValidatorDefaults)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "section pool")
+
+	_, err = openFromString("tls:\n  enabled: true\n", testConfigValidatorDefaults)
+	require.NotNil(t, err)
+
+	_, err = openFromString("mounts:\n  music:\n    path: \"\"\n", testConfigValidatorDefaults)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "section mounts.music")
+
+	cfg, err := openFromString("pool:\n  min_conns: 5\n", testConfigValidatorDefaults)
+	require.Nil(t, err)
+	require.Equal(t, int64(5), cfg.Int("pool.min_conns"))
+}
+
+func TestConfigValidatorSet(t *testing.T) {
+	cfg, err := Open(nil, testConfigValidatorDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	callCount := 0
+	cfg.AddEvent("", func(key string) {
+		callCount++
+	})
+
+	require.NotNil(t, cfg.SetInt("pool.min_conns", 20))
+	require.Equal(t, int64(1), cfg.Int("pool.min_conns"))
+	require.True(t, cfg.IsDefault("pool.min_conns"))
+
+	require.NotNil(t, cfg.SetBool("tls.enabled", true))
+	require.False(t, cfg.Bool("tls.enabled"))
+	require.Equal(t, 0, callCount)
+
+	// Works if both are set at once:
+	tx := cfg.Begin()
+	require.Nil(t, tx.SetString("tls.key", "/etc/tls.key"))
+	require.Nil(t, tx.SetBool("tls.enabled", true))
+	require.Nil(t, tx.Commit())
+	require.True(t, cfg.Bool("tls.enabled"))
+	require.Equal(t, 2, callCount)
+
+	// Sections below __many__ are validated too:
+	require.NotNil(t, cfg.SetString("mounts.music.path", ""))
+	require.Nil(t, cfg.SetString("mounts.music.path", "/music"))
+	require.Equal(t, "/music", cfg.String("mounts.music.path"))
+}
+
+func TestConfigValidatorReloadMerge(t *testing.T) {
+	cfg, err := Open(nil, testConfigValidatorDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	require.NotNil(t, cfg.Reload(NewYamlDecoder(strings.NewReader("pool:\n  max_conns: 0\n"))))
+	require.Equal(t, int64(10), cfg.Int("pool.max_conns"))
+
+	other, err := Open(nil, testConfigValidatorDefaults, StrictnessPanic)
+	require.Nil(t, err)
+	require.Nil(t, other.SetInt("pool.max_conns", 50))
+	require.Nil(t, other.SetInt("pool.min_conns", 40))
+	require.Nil(t, cfg.Merge(other))
+	require.Equal(t, int64(40), cfg.Int("pool.min_conns"))
+
+	other, err = Open(nil, testConfigValidatorDefaults, StrictnessPanic)
+	require.Nil(t, err)
+	require.Nil(t, other.SetInt("pool.max_conns", 20))
+
+	// Would result in min=40 and max=20:
+	require.NotNil(t, cfg.Merge(other))
+	require.Equal(t, int64(50), cfg.Int("pool.max_conns"))
+}
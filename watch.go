@@ -0,0 +1,182 @@
+package config
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	e "github.com/pkg/errors"
+)
+
+// WatchOptions can be passed to Watch() to configure it.
+// The zero value is valid and uses the defaults noted below.
+type WatchOptions struct {
+	// Interval defines how often the file is checked for changes.
+	// Defaults to 500ms.
+	Interval time.Duration
+
+	// Debounce is the time the file has to stay unchanged before it is
+	// reloaded. This avoids reloading half-written files when an editor
+	// or tool writes in several bursts. Defaults to 250ms.
+	Debounce time.Duration
+
+	// NewDecoder creates a decoder for the file contents.
+	// Defaults to NewYamlDecoder.
+	NewDecoder func(r io.Reader) Decoder
+
+	// OnError is called when the file could not be read or did not pass
+	// validation. The config keeps its last good state in this case.
+	OnError func(err error)
+}
+
+// FileWatcher reloads a config when the file it was loaded from changes.
+// See Watch() for details.
+type FileWatcher struct {
+	path string
+	cfg  *Config
+	opts WatchOptions
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// state of the last check:
+	lastInfo os.FileInfo
+	lastData []byte
+
+	// set when the file changed, but was not loaded yet:
+	pendingSince time.Time
+}
+
+// Watch checks the file at `path` periodically and calls Reload() on `cfg`
+// with its contents once it changed. This causes all callbacks registered
+// via AddEvent() to fire for the changed keys.
+//
+// The file is polled instead of relying on OS specific notifications. Since
+// the path is looked up on every check, editors that save by writing a new
+// file and renaming it over the old one are supported.
+//
+// The current contents of `path` are assumed to be loaded into `cfg` already.
+// `opts` may be nil. Call Close() on the returned watcher to stop watching.
+func Watch(path string, cfg *Config, opts *WatchOptions) (*FileWatcher, error) {
+	fw := &FileWatcher{
+		path: path,
+		cfg:  cfg,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	if opts != nil {
+		fw.opts = *opts
+	}
+
+	if fw.opts.Interval <= 0 {
+		fw.opts.Interval = 500 * time.Millisecond
+	}
+
+	if fw.opts.Debounce <= 0 {
+		fw.opts.Debounce = 250 * time.Millisecond
+	}
+
+	if fw.opts.NewDecoder == nil {
+		fw.opts.NewDecoder = NewYamlDecoder
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fw.lastInfo = info
+	fw.lastData = data
+
+	go fw.loop()
+	return fw, nil
+}
+
+// Close stops watching. It's safe to call it several times.
+func (fw *FileWatcher) Close() error {
+	fw.stopOnce.Do(func() {
+		close(fw.stop)
+	})
+
+	<-fw.done
+	return nil
+}
+
+func (fw *FileWatcher) loop() {
+	defer close(fw.done)
+
+	ticker := time.NewTicker(fw.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fw.stop:
+			return
+		case now := <-ticker.C:
+			fw.check(now)
+		}
+	}
+}
+
+func (fw *FileWatcher) reportError(err error) {
+	if fw.opts.OnError != nil {
+		fw.opts.OnError(err)
+	}
+}
+
+func isSameFileInfo(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) &&
+		a.Size() == b.Size() &&
+		a.ModTime().Equal(b.ModTime())
+}
+
+func (fw *FileWatcher) check(now time.Time) {
+	info, err := os.Stat(fw.path)
+	if err != nil {
+		// The file might be in the middle of being replaced.
+		// We'll see it again on the next check.
+		return
+	}
+
+	if !isSameFileInfo(info, fw.lastInfo) {
+		// Still being written to (or just started); wait until it settles.
+		fw.lastInfo = info
+		fw.pendingSince = now
+		return
+	}
+
+	if fw.pendingSince.IsZero() || now.Sub(fw.pendingSince) < fw.opts.Debounce {
+		return
+	}
+
+	fw.pendingSince = time.Time{}
+
+	data, err := ioutil.ReadFile(fw.path)
+	if err != nil {
+		fw.reportError(e.Wrapf(err, "read %s", fw.path))
+		return
+	}
+
+	if bytes.Equal(data, fw.lastData) {
+		// Only touched, but not modified.
+		return
+	}
+
+	// Remember the data even if it's broken, so we don't
+	// report the same error over and over again.
+	fw.lastData = data
+
+	if err := fw.cfg.Reload(fw.opts.NewDecoder(bytes.NewReader(data))); err != nil {
+		fw.reportError(e.Wrapf(err, "reload %s", fw.path))
+	}
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func waitFor(t *testing.T, fn func() bool) {
+	for idx := 0; idx < 200; idx++ {
+		if fn() {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("condition was not met in time")
+}
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-watch-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yml")
+	require.Nil(t, ioutil.WriteFile(path, []byte("daemon:\n  port: 1000\n"), 0600))
+
+	cfg, err := FromYamlFile(path, TestDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	mu := &sync.Mutex{}
+	changes := 0
+	cfg.AddEvent("daemon.port", func(key string) {
+		mu.Lock()
+		changes++
+		mu.Unlock()
+	})
+
+	errs := make(chan error, 10)
+	fw, err := Watch(path, cfg, &WatchOptions{
+		Interval: 5 * time.Millisecond,
+		Debounce: 10 * time.Millisecond,
+		OnError: func(err error) {
+			errs <- err
+		},
+	})
+	require.Nil(t, err)
+	defer fw.Close()
+
+	// Plain write:
+	require.Nil(t, ioutil.WriteFile(path, []byte("daemon:\n  port: 2000\n"), 0600))
+	waitFor(t, func() bool { return cfg.Int("daemon.port") == 2000 })
+
+	mu.Lock()
+	require.Equal(t, 1, changes)
+	mu.Unlock()
+
+	// Editor style: write a new file and rename it over the old one.
+	tmpPath := filepath.Join(dir, "config.yml.tmp")
+	require.Nil(t, ioutil.WriteFile(tmpPath, []byte("daemon:\n  port: 3000\n"), 0600))
+	require.Nil(t, os.Rename(tmpPath, path))
+	waitFor(t, func() bool { return cfg.Int("daemon.port") == 3000 })
+
+	// Invalid file; the old state should stay:
+	require.Nil(t, ioutil.WriteFile(path, []byte("daemon:\n  port: 0\n"), 0600))
+	select {
+	case err := <-errs:
+		require.NotNil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no error was reported")
+	}
+
+	require.Equal(t, int64(3000), cfg.Int("daemon.port"))
+	require.Nil(t, fw.Close())
+	require.Nil(t, fw.Close())
+}
+
+func TestWatchMissingFile(t *testing.T) {
+	cfg, err := Open(nil, TestDefaults, StrictnessPanic)
+	require.Nil(t, err)
+
+	_, err = Watch("/this/path/should/not/exist.yml", cfg, nil)
+	require.NotNil(t, err)
+}